@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+type AnthropicRequest struct {
+	System      []AnthropicContent   `json:"system,omitempty"`
+	Messages    []AnthropicMessage   `json:"messages"`
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature float64              `json:"temperature,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+	Tools       []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *AnthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type AnthropicMessage struct {
+	Role    string             `json:"role"`
+	Content []AnthropicContent `json:"content"`
+}
+
+type AnthropicContent struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text"`
+	CacheControl *AnthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type AnthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type AnthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type AnthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage AnthropicUsage `json:"usage"`
+}
+
+type AnthropicModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Usage AnthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+const (
+	anthropicMessagesURL = "https://api.anthropic.com/v1/messages"
+	anthropicModelsURL   = "https://api.anthropic.com/v1/models"
+)
+
+type anthropicProvider struct{}
+
+func init() {
+	registerProvider(anthropicProvider{})
+}
+
+func (anthropicProvider) Name() string { return "Anthropic" }
+
+func (anthropicProvider) Auth() AuthRequirements {
+	return AuthRequirements{APIKeyEnv: "ANTHROPIC_API_KEY"}
+}
+
+func (anthropicProvider) DefaultEmbeddingModel() string { return "" }
+
+func (anthropicProvider) SupportsChat() bool { return true }
+
+func (anthropicProvider) SupportsEmbeddings() bool { return false }
+
+func (p anthropicProvider) ListModels() ([]string, error) {
+	return discoverModels(p.Name(), []string{"claude-3-5-sonnet-20240620"}, getAnthropicModels), nil
+}
+
+func getAnthropicModels(ctx context.Context) ([]string, error) {
+	var resp AnthropicModelsResponse
+	if err := getJSON(ctx, anthropicModelsURL+"?limit=1000", anthropicHeaders(getAPIKey("Anthropic")), &resp); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, model := range resp.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func (anthropicProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	req := newAnthropicRequest(model, messages)
+	return makeAPICall(ctx, anthropicMessagesURL, req, anthropicHeaders(apiKey), processAnthropicResponse)
+}
+
+func (anthropicProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	req := newAnthropicRequest(model, messages)
+	req.Stream = true
+	return makeStreamingAPICall(ctx, anthropicMessagesURL, req, anthropicHeaders(apiKey), processAnthropicStreamEvent, onDelta)
+}
+
+// ChatStructured forces a call to a tool named after the output, whose
+// input is the structured object.
+func (anthropicProvider) ChatStructured(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput) (string, error) {
+	req := newAnthropicToolRequest(model, messages, output)
+	return makeAPICall(ctx, anthropicMessagesURL, req, anthropicHeaders(apiKey), anthropicToolResponse(output.Name))
+}
+
+// ChatStructuredStream streams the tool input as input_json_delta events.
+func (anthropicProvider) ChatStructuredStream(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput, onDelta func(string)) (string, error) {
+	req := newAnthropicToolRequest(model, messages, output)
+	req.Stream = true
+	return makeStreamingAPICall(ctx, anthropicMessagesURL, req, anthropicHeaders(apiKey), processAnthropicStreamEvent, onDelta)
+}
+
+func newAnthropicToolRequest(model string, messages []AIMessage, output StructuredOutput) AnthropicRequest {
+	req := newAnthropicRequest(model, messages)
+	req.Tools = []AnthropicTool{{
+		Name:        output.Name,
+		Description: output.Description,
+		InputSchema: output.Schema,
+	}}
+	req.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: output.Name}
+	return req
+}
+
+func (anthropicProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	return nil, fmt.Errorf("Embeddings are not supported for Anthropic")
+}
+
+func anthropicHeaders(apiKey string) map[string]string {
+	return map[string]string{
+		"Content-Type":      "application/json",
+		"x-api-key":         apiKey,
+		"anthropic-version": "2023-06-01",
+	}
+}
+
+// newAnthropicRequest marks the system prompt and the end of the
+// conversation as cache breakpoints, so each retry reads the prompt and the
+// earlier turns from the cache instead of paying for them again.
+func newAnthropicRequest(model string, messages []AIMessage) AnthropicRequest {
+	req := AnthropicRequest{
+		Model:       model,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+	if system := systemMessage(messages); system != "" {
+		req.System = []AnthropicContent{{Type: "text", Text: system}}
+	}
+	for _, msg := range filterSystemMessages(messages) {
+		req.Messages = append(req.Messages, AnthropicMessage{
+			Role:    msg.Role,
+			Content: []AnthropicContent{{Type: "text", Text: msg.Content}},
+		})
+	}
+	if viper.GetBool("anthropic.prompt_caching") {
+		if len(req.System) > 0 {
+			req.System[0].CacheControl = &AnthropicCacheControl{Type: "ephemeral"}
+		}
+		if n := len(req.Messages); n > 0 {
+			req.Messages[n-1].Content[0].CacheControl = &AnthropicCacheControl{Type: "ephemeral"}
+		}
+	}
+	return req
+}
+
+func (u AnthropicUsage) report(usage *Usage) {
+	usage.update(u.InputTokens, u.OutputTokens)
+	usage.updateCache(u.CacheReadInputTokens, u.CacheCreationInputTokens)
+}
+
+func processAnthropicResponse(body []byte, usage *Usage) (string, error) {
+	var apiResp AnthropicResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	if len(apiResp.Content) == 0 || apiResp.Content[0].Text == "" {
+		return "", fmt.Errorf("The LLM returned an empty response")
+	}
+	apiResp.Usage.report(usage)
+	return apiResp.Content[0].Text, nil
+}
+
+func anthropicToolResponse(toolName string) func([]byte, *Usage) (string, error) {
+	return func(body []byte, usage *Usage) (string, error) {
+		var apiResp AnthropicResponse
+		if err := json.Unmarshal(body, &apiResp); err != nil {
+			return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+		}
+		apiResp.Usage.report(usage)
+		for _, block := range apiResp.Content {
+			if block.Type == "tool_use" && block.Name == toolName {
+				return string(block.Input), nil
+			}
+		}
+		return "", fmt.Errorf("The LLM did not call the %s tool", toolName)
+	}
+}
+
+func processAnthropicStreamEvent(data []byte, usage *Usage) (string, error) {
+	var event AnthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("Error unmarshaling stream event: %v", err)
+	}
+	switch event.Type {
+	case "message_start":
+		event.Message.Usage.report(usage)
+	case "message_delta":
+		event.Usage.report(usage)
+	case "content_block_delta":
+		if event.Delta.Type == "input_json_delta" {
+			return event.Delta.PartialJSON, nil
+		}
+		return event.Delta.Text, nil
+	case "error":
+		return "", fmt.Errorf("Anthropic stream error: %s", event.Error.Message)
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	azureProviderName      = "Azure OpenAI"
+	azureDefaultAPIVersion = "2024-06-01"
+)
+
+// azureOpenAIProvider routes requests to Azure OpenAI deployments. The model
+// name is the deployment name; resource, deployments and API version are
+// stored under the azure_openai key in ai-config.yaml.
+type azureOpenAIProvider struct{}
+
+func init() {
+	registerProvider(azureOpenAIProvider{})
+}
+
+func (azureOpenAIProvider) Name() string { return azureProviderName }
+
+func (azureOpenAIProvider) Auth() AuthRequirements {
+	return AuthRequirements{
+		APIKeyEnv:    "AZURE_OPENAI_API_KEY",
+		BaseURLKey:   "azure_openai.resource",
+		BaseURLLabel: "resource name",
+	}
+}
+
+func (azureOpenAIProvider) DefaultEmbeddingModel() string {
+	return viper.GetString("azure_openai.embedding_deployment")
+}
+
+func (azureOpenAIProvider) ListModels() ([]string, error) {
+	return viper.GetStringSlice("azure_openai.deployments"), nil
+}
+
+// saveAzureDeployment records a deployment chosen in ai config, so it is
+// listed next time and the API version is written out alongside it.
+func saveAzureDeployment(deployment string, embeddings bool) {
+	if deployment == "" {
+		return
+	}
+	if viper.GetString("azure_openai.api_version") == "" {
+		viper.Set("azure_openai.api_version", azureDefaultAPIVersion)
+	}
+	if embeddings {
+		viper.Set("azure_openai.embedding_deployment", deployment)
+		return
+	}
+	deployments := viper.GetStringSlice("azure_openai.deployments")
+	if !slices.Contains(deployments, deployment) {
+		viper.Set("azure_openai.deployments", append(deployments, deployment))
+	}
+}
+
+func (p azureOpenAIProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	apiURL, err := p.deploymentURL(model, "chat/completions")
+	if err != nil {
+		return "", err
+	}
+	return openAIChat(ctx, apiURL, azureHeaders(apiKey), model, messages)
+}
+
+func (p azureOpenAIProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	apiURL, err := p.deploymentURL(model, "chat/completions")
+	if err != nil {
+		return "", err
+	}
+	return openAIChatStream(ctx, apiURL, azureHeaders(apiKey), model, messages, false, onDelta)
+}
+
+func (p azureOpenAIProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	apiURL, err := p.deploymentURL(model, "embeddings")
+	if err != nil {
+		return nil, err
+	}
+	return openAIEmbeddings(ctx, apiURL, azureHeaders(apiKey), model, input)
+}
+
+func (azureOpenAIProvider) deploymentURL(deployment, operation string) (string, error) {
+	resource := strings.TrimRight(viper.GetString("azure_openai.resource"), "/")
+	if resource == "" {
+		return "", fmt.Errorf("Azure OpenAI resource not set. Use 'ai config' or set azure_openai.resource in %s", configFileName)
+	}
+	if deployment == "" {
+		return "", fmt.Errorf("Azure OpenAI deployment not set")
+	}
+	baseURL := resource
+	if !strings.Contains(resource, "://") {
+		baseURL = fmt.Sprintf("https://%s.openai.azure.com", resource)
+	}
+	apiVersion := viper.GetString("azure_openai.api_version")
+	if apiVersion == "" {
+		apiVersion = azureDefaultAPIVersion
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/%s?api-version=%s",
+		baseURL, url.PathEscape(deployment), operation, url.QueryEscape(apiVersion)), nil
+}
+
+func azureHeaders(apiKey string) map[string]string {
+	return map[string]string{
+		"Content-Type": "application/json",
+		"api-key":      apiKey,
+	}
+}
@@ -1,48 +1,136 @@
 package cmd
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	badger "github.com/dgraph-io/badger/v4"
 	"github.com/spf13/viper"
 	usearch "github.com/unum-cloud/usearch/golang"
 )
 
+// Embedding is a vector with the embedder that produced it. Each embedder
+// has its own index, so vectors from different embedders are never compared.
+type Embedding struct {
+	Vector   []float32
+	Embedder string
+}
+
 var (
-	index       *usearch.Index
+	indexes     = map[string]*usearch.Index{}
 	db          *badger.DB
 	keyToUint64 map[string]uint64
 	uint64ToKey map[uint64]string
 	apiKey      string
+
+	nonSlugPattern = regexp.MustCompile(`[^a-z0-9]+`)
 )
 
-func computeVector(value string) []float32 {
+// embeddingsProviderName returns embeddings_provider, or else the chat
+// provider. Local Rules is meant to work without a network, so its cache
+// uses local embeddings.
+func embeddingsProviderName() string {
+	if provider := viper.GetString("embeddings_provider"); provider != "" {
+		return provider
+	}
 	provider := viper.GetString("provider")
-	model := viper.GetString("embedding_model")
+	if provider == localRulesName {
+		return localEmbedderName
+	}
+	return provider
+}
+
+func embeddingsModelName(provider string) string {
+	model := viper.GetString("embeddings_model")
 	if model == "" {
-		if provider == "OpenAI" {
-			model = "text-embedding-3-small"
-		} else if provider == "Ollama" {
-			model = "bge-m3"
+		model = viper.GetString("embedding_model")
+	}
+	if model == "" {
+		if p, err := getProvider(provider); err == nil {
+			model = p.DefaultEmbeddingModel()
 		}
-	} else {
-		fmt.Printf("No default embedding model specified for provider %s\n", provider)
-		os.Exit(1)
+	}
+	return model
+}
+
+func computeVector(ctx context.Context, value string) Embedding {
+	provider := embeddingsProviderName()
+	if provider == localEmbedderName {
+		return localEmbedding(value)
+	}
+	if p, err := getProvider(provider); err == nil && !supportsEmbeddings(p) {
+		return embeddingFallback(value, fmt.Sprintf("%s does not provide embeddings. Choose an embeddings provider with 'ai config' or set embeddings_provider in %s.", provider, configFileName), true)
+	}
+	model := embeddingsModelName(provider)
+	if model == "" {
+		return embeddingFallback(value, fmt.Sprintf("No default embedding model specified for provider %s.", provider), true)
 	}
 	apiKey := getAPIKey(provider)
-	if apiKey == "" {
-		fmt.Printf("Error: API key not set for provider %s. Use 'ai config' or set the appropriate environment variable.\n", provider)
-		os.Exit(1)
+	if apiKey == "" && requiresAPIKey(provider) {
+		return embeddingFallback(value, fmt.Sprintf("API key not set for provider %s. Use 'ai config' or set the appropriate environment variable.", provider), true)
+	}
+	if period, limit, spent := exceededBudget(time.Now()); period != "" {
+		return embeddingFallback(value, fmt.Sprintf("%s budget of $%.2f used up ($%.2f spent).", capitalize(period), limit, spent), false)
+	}
+	embeddings, err := callAPI[[]float32](ctx, provider, model, apiKey, value, EmbeddingsRequest)
+	if ctx.Err() != nil {
+		return Embedding{}
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError) || errors.Is(err, ErrNetwork) {
+		return embeddingFallback(value, describeAPIError(provider, err), false)
+	}
+	if err != nil {
+		return embeddingFallback(value, describeAPIError(provider, err), true)
+	}
+	return Embedding{Vector: embeddings, Embedder: embedderTag(provider, model, len(embeddings))}
+}
+
+func embedderTag(provider, model string, dims int) string {
+	return fmt.Sprintf("%s/%s/%d", provider, model, dims)
+}
+
+// indexFileFor names the index file after the embedder, e.g.
+// index-openai-text-embedding-3-small-1536.usearch.
+func indexFileFor(embedder string) string {
+	slug := strings.Trim(nonSlugPattern.ReplaceAllString(strings.ToLower(embedder), "-"), "-")
+	return filepath.Join(storeDir, "index-"+slug+filepath.Ext(indexFileName))
+}
+
+// loadIndex opens the index for an embedder, creating it on first use. An
+// index from before indexes were tagged belongs to the configured embedder.
+func loadIndex(embedding Embedding) (*usearch.Index, error) {
+	if index, ok := indexes[embedding.Embedder]; ok {
+		return index, nil
+	}
+	path := indexFileFor(embedding.Embedder)
+	provider := embeddingsProviderName()
+	if embedding.Embedder == embedderTag(provider, embeddingsModelName(provider), vectorSize) {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			os.Rename(indexFile, path)
+		}
 	}
-	embeddings, err := callAPI[[]float32](provider, model, apiKey, value, EmbeddingsRequest)
+
+	index, err := usearch.NewIndex(usearch.DefaultConfig(uint(len(embedding.Vector))))
 	if err != nil {
-		fmt.Printf("Error calling embeddings API: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("Failed to create Index: %v", err)
 	}
-	return embeddings
+	if err := index.Load(path); err != nil {
+		if err := index.Save(path); err != nil {
+			index.Destroy()
+			return nil, fmt.Errorf("Failed to save index: %v", err)
+		}
+		fmt.Println("New index created and saved successfully.")
+	}
+	indexes[embedding.Embedder] = index
+	return index, nil
 }
 
 func stringToUint64(s string) (uint64, error) {
@@ -53,17 +141,21 @@ func stringToUint64(s string) (uint64, error) {
 	return binary.BigEndian.Uint64(b), nil
 }
 
-func addToVecDB(vector []float32, key string, value string) error {
-	if index == nil {
-		panic("Vector index not initialized")
+func addToVecDB(embedding Embedding, key string, value string) error {
+	if embedding.Vector == nil {
+		return nil
+	}
+	index, err := loadIndex(embedding)
+	if err != nil {
+		return err
 	}
 	uintKey := hashString(key)
-	err := index.Reserve(uint(1))
+	err = index.Reserve(uint(1))
 	if err != nil {
 		return fmt.Errorf("failed to reserve space in index: %v", err)
 	}
 
-	err = index.Add(uintKey, vector)
+	err = index.Add(uintKey, embedding.Vector)
 	if err != nil {
 		return fmt.Errorf("failed to add vector to index: %v", err)
 	}
@@ -75,7 +167,7 @@ func addToVecDB(vector []float32, key string, value string) error {
 		return fmt.Errorf("failed to store value in BadgerDB: %v", err)
 	}
 
-	err = index.Save(indexFile)
+	err = index.Save(indexFileFor(embedding.Embedder))
 	if err != nil {
 		return fmt.Errorf("failed to save index: %v", err)
 	}
@@ -109,12 +201,16 @@ func getFromDB(key []byte) (string, error) {
 	return string(valCopy), nil
 }
 
-func getCachedResponse(textCommand string) (string, bool, []float32) {
-	if index == nil {
-		panic("Vector index is unavailable")
+func getCachedResponse(ctx context.Context, textCommand string) (string, bool, Embedding) {
+	vector := computeVector(ctx, textCommand)
+	if vector.Vector == nil {
+		return "", false, vector
+	}
+	index, err := loadIndex(vector)
+	if err != nil {
+		panic(err.Error())
 	}
-	vector := computeVector(textCommand)
-	keys, distances, err := index.Search(vector, uint(k))
+	keys, distances, err := index.Search(vector.Vector, uint(k))
 	if err != nil {
 		panic(fmt.Sprintf("Failed to search Index: %v", err))
 	}
@@ -124,6 +220,9 @@ func getCachedResponse(textCommand string) (string, bool, []float32) {
 	key := keys[0]
 	distance := distances[0]
 	maxDistance := viper.GetFloat64("max_distance")
+	if strings.HasPrefix(vector.Embedder, localEmbedderName+"/") {
+		maxDistance = viper.GetFloat64("local_embeddings.max_distance")
+	}
 	if maxDistance == 0 {
 		maxDistance = defaultMaxDistance
 	}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+const candidatesPrompt = "Suggest %d different commands for this, best first, each with a one-line explanation."
+
+type pickerModel struct {
+	list   list.Model
+	choice int
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			return m, tea.Quit
+		case tea.KeyEnter:
+			m.choice = m.list.Index()
+			return m, tea.Quit
+		}
+	case tea.WindowSizeMsg:
+		m.list.SetWidth(msg.Width)
+	}
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m pickerModel) View() string {
+	if m.choice >= 0 {
+		return ""
+	}
+	return m.list.View()
+}
+
+// pickCommand lets the user choose one of the candidates. It returns -1 if
+// the user cancelled.
+func pickCommand(ctx context.Context, commands []Command) (int, error) {
+	items := []list.Item{}
+	for _, cmd := range commands {
+		desc := cmd.Explanation
+		if cmd.RiskLevel != "" {
+			desc = fmt.Sprintf("[%s risk] %s", cmd.RiskLevel, desc)
+		}
+		items = append(items, item{title: cmd.Content, desc: desc})
+	}
+	l := list.New(items, list.NewDefaultDelegate(), 80, len(items)*3+4)
+	l.Title = "Select a command"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+
+	result, err := tea.NewProgram(pickerModel{list: l, choice: -1}, tea.WithContext(ctx)).Run()
+	if err != nil {
+		return -1, err
+	}
+	return result.(pickerModel).choice, nil
+}
+
+// candidatePrompt builds the user message, asking for n alternatives and
+// steering the model away from commands rejected for the same request.
+func candidatePrompt(textCommand string, n int) string {
+	prompt := textCommand
+	if n > 1 {
+		prompt += "\n\n" + fmt.Sprintf(candidatesPrompt, n)
+	}
+	if rejected := getRejected(textCommand); len(rejected) > 0 {
+		prompt += "\n\nDo not suggest these commands, which were already rejected:\n" + strings.Join(rejected, "\n")
+	}
+	return prompt
+}
+
+// withoutRejected drops candidates rejected earlier for the same request,
+// unless that would leave nothing to choose from.
+func withoutRejected(textCommand string, commands []Command) []Command {
+	rejected := map[string]bool{}
+	for _, command := range getRejected(textCommand) {
+		rejected[command] = true
+	}
+	var kept []Command
+	for _, cmd := range commands {
+		if !rejected[cmd.Content] {
+			kept = append(kept, cmd)
+		}
+	}
+	if len(kept) == 0 {
+		return commands
+	}
+	return kept
+}
+
+func rejectedKey(textCommand string) []byte {
+	return []byte("rejected:" + strings.ToLower(strings.TrimSpace(textCommand)))
+}
+
+func getRejected(textCommand string) []string {
+	var rejected []string
+	db.View(func(txn *badger.Txn) error {
+		entry, err := txn.Get(rejectedKey(textCommand))
+		if err != nil {
+			return err
+		}
+		return entry.Value(func(val []byte) error {
+			return json.Unmarshal(val, &rejected)
+		})
+	})
+	return rejected
+}
+
+func addRejected(textCommand string, commands []string) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	rejected := getRejected(textCommand)
+	seen := map[string]bool{}
+	for _, command := range rejected {
+		seen[command] = true
+	}
+	for _, command := range commands {
+		if !seen[command] {
+			rejected = append(rejected, command)
+			seen[command] = true
+		}
+	}
+	data, err := json.Marshal(rejected)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set(rejectedKey(textCommand), data)
+	})
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+var ErrCassetteMiss = errors.New("no recorded response in the cassette")
+
+const redacted = "REDACTED"
+
+type CassetteRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+}
+
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// cassette records provider HTTP traffic to a file, or replays it from one
+// so runs are deterministic and need no network. Interactions are replayed
+// in order, preferring an exact request match over one with the same URL.
+type cassette struct {
+	mu           sync.Mutex
+	path         string
+	mode         string
+	interactions []Interaction
+	used         []bool
+}
+
+var (
+	activeCassette     *cassette
+	activeCassetteErr  error
+	activeCassetteOnce sync.Once
+)
+
+func cassetteMode() string {
+	return strings.ToLower(viper.GetString("cassette.mode"))
+}
+
+func replayingCassette() bool {
+	return cassetteMode() == "replay"
+}
+
+func cassettePath() string {
+	if path := viper.GetString("cassette.file"); path != "" {
+		return expandHome(path)
+	}
+	return filepath.Join(storeDir, cassetteFileName)
+}
+
+// loadCassette opens the cassette selected by the config, environment or
+// flags, or returns nil when recording and replay are off.
+func loadCassette() (*cassette, error) {
+	activeCassetteOnce.Do(func() {
+		mode := cassetteMode()
+		switch mode {
+		case "", "off":
+			return
+		case "record", "replay":
+		default:
+			activeCassetteErr = fmt.Errorf("Invalid cassette mode %q: use record or replay", mode)
+			return
+		}
+		c := &cassette{path: cassettePath(), mode: mode}
+		if mode == "replay" {
+			data, err := os.ReadFile(c.path)
+			if err != nil {
+				activeCassetteErr = fmt.Errorf("Error reading cassette: %v", err)
+				return
+			}
+			if err := json.Unmarshal(data, &c.interactions); err != nil {
+				activeCassetteErr = fmt.Errorf("Error parsing cassette %s: %v", c.path, err)
+				return
+			}
+			c.used = make([]bool, len(c.interactions))
+		}
+		activeCassette = c
+	})
+	return activeCassette, activeCassetteErr
+}
+
+func (c *cassette) transport(next http.RoundTripper) http.RoundTripper {
+	return &cassetteTransport{cassette: c, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := CassetteRequest{
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		Headers: redactHeaders(req.Header),
+		Body:    string(body),
+	}
+
+	if t.cassette.mode == "replay" {
+		interaction, ok := t.cassette.next(recorded)
+		if !ok {
+			return nil, fmt.Errorf("%w for %s %s", ErrCassetteMiss, recorded.Method, recorded.URL)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(data []byte) {
+			t.cassette.record(Interaction{
+				Request: recorded,
+				Response: CassetteResponse{
+					StatusCode: resp.StatusCode,
+					Headers:    resp.Header.Clone(),
+					Body:       string(data),
+				},
+			})
+		},
+	}
+	return resp, nil
+}
+
+func (c *cassette) next(req CassetteRequest) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	match := -1
+	for i, interaction := range c.interactions {
+		if c.used[i] || interaction.Request.Method != req.Method || interaction.Request.URL != req.URL {
+			continue
+		}
+		if interaction.Request.Body == req.Body {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return Interaction{}, false
+	}
+	c.used[match] = true
+	return c.interactions[match], true
+}
+
+func (c *cassette) record(interaction Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, interaction)
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		fmt.Printf("Failed to save cassette: %v\n", err)
+	}
+}
+
+// recordingBody passes a response through unchanged, so streaming still
+// works while recording, and hands over everything read once it is closed.
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+	once sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+	return b.ReadCloser.Close()
+}
+
+func isSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, marker := range []string{"key", "token", "secret", "authorization", "password"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(headers http.Header) http.Header {
+	clean := http.Header{}
+	for name, values := range headers {
+		if isSecretName(name) {
+			clean[name] = []string{redacted}
+		} else {
+			clean[name] = values
+		}
+	}
+	return clean
+}
+
+func redactURL(u *url.URL) string {
+	clean := *u
+	clean.User = nil
+	query := clean.Query()
+	for name := range query {
+		if isSecretName(name) {
+			query.Set(name, redacted)
+		}
+	}
+	clean.RawQuery = query.Encode()
+	return clean.String()
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+type CloudflareRequest struct {
+	Messages    []AIMessage `json:"messages"`
+	MaxTokens   int         `json:"max_tokens"`
+	Temperature float64     `json:"temperature,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+}
+
+type CloudflareResponse struct {
+	Result struct {
+		Response string `json:"response"`
+		Usage    Usage  `json:"usage"`
+	} `json:"result"`
+}
+
+type CloudflareEmbeddingRequest struct {
+	Text []string `json:"text"`
+}
+
+type CloudflareEmbeddingResponse struct {
+	Result struct {
+		Shape []int       `json:"shape"`
+		Data  [][]float32 `json:"data"`
+	} `json:"result"`
+}
+
+type CloudflareModelsResponse struct {
+	Result []struct {
+		Name string `json:"name"`
+	} `json:"result"`
+}
+
+type CloudflareStreamEvent struct {
+	Response string `json:"response"`
+	Usage    Usage  `json:"usage"`
+}
+
+type cloudflareProvider struct{}
+
+func init() {
+	registerProvider(cloudflareProvider{})
+}
+
+func (cloudflareProvider) Name() string { return "Cloudflare" }
+
+func (cloudflareProvider) Auth() AuthRequirements {
+	return AuthRequirements{
+		APIKeyEnv:    "CLOUDFLARE_API_KEY",
+		AccountIDKey: "cloudflare_account_id",
+		AccountIDEnv: "CLOUDFLARE_ACCOUNT_ID",
+	}
+}
+
+func (cloudflareProvider) DefaultEmbeddingModel() string { return "@cf/baai/bge-base-en-v1.5" }
+
+func (p cloudflareProvider) ListModels() ([]string, error) {
+	return discoverModels(p.Name(), []string{"@cf/meta/llama-3.1-8b-instruct"}, p.getModels), nil
+}
+
+// getModels lists the Workers AI text generation models.
+func (p cloudflareProvider) getModels(ctx context.Context) ([]string, error) {
+	accountID := getAccountID(p.Name())
+	if accountID == "" {
+		return nil, fmt.Errorf("Cloudflare Account ID not set")
+	}
+	apiURL := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/models/search?task=%s&per_page=1000", accountID, url.QueryEscape("Text Generation"))
+	var resp CloudflareModelsResponse
+	if err := getJSON(ctx, apiURL, cloudflareHeaders(getAPIKey(p.Name())), &resp); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, model := range resp.Result {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
+
+func (p cloudflareProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	apiURL, err := p.runURL(model)
+	if err != nil {
+		return "", err
+	}
+	req := CloudflareRequest{
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+	return makeAPICall(ctx, apiURL, req, cloudflareHeaders(apiKey), processCloudflareResponse)
+}
+
+func (p cloudflareProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	apiURL, err := p.runURL(model)
+	if err != nil {
+		return "", err
+	}
+	req := CloudflareRequest{
+		Messages:    messages,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+		Stream:      true,
+	}
+	return makeStreamingAPICall(ctx, apiURL, req, cloudflareHeaders(apiKey), processCloudflareStreamEvent, onDelta)
+}
+
+func (p cloudflareProvider) runURL(model string) (string, error) {
+	accountID := getAccountID(p.Name())
+	if accountID == "" {
+		return "", fmt.Errorf("Cloudflare Account ID not set. Use 'ai config' or set the CLOUDFLARE_ACCOUNT_ID environment variable")
+	}
+	return fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/run/%s", accountID, model), nil
+}
+
+func cloudflareHeaders(apiKey string) map[string]string {
+	return map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer " + apiKey,
+	}
+}
+
+func (p cloudflareProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	apiURL, err := p.runURL(model)
+	if err != nil {
+		return nil, err
+	}
+	req := CloudflareEmbeddingRequest{Text: []string{input}}
+	return makeAPICall(ctx, apiURL, req, cloudflareHeaders(apiKey), processCloudflareEmbeddingResponse)
+}
+
+func processCloudflareResponse(body []byte, usage *Usage) (string, error) {
+	var apiResp CloudflareResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	if apiResp.Result.Response == "" {
+		return "", fmt.Errorf("No result in the API response")
+	}
+	*usage = apiResp.Result.Usage
+	return apiResp.Result.Response, nil
+}
+
+func processCloudflareStreamEvent(data []byte, usage *Usage) (string, error) {
+	var event CloudflareStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("Error unmarshaling stream event: %v", err)
+	}
+	usage.update(event.Usage.PromptTokens, event.Usage.CompletionTokens)
+	return event.Response, nil
+}
+
+func processCloudflareEmbeddingResponse(body []byte, usage *Usage) ([]float32, error) {
+	var resp CloudflareEmbeddingResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling embeddings response: %v", err)
+	}
+	if len(resp.Result.Data) == 0 {
+		return nil, fmt.Errorf("No embeddings returned")
+	}
+	return resp.Result.Data[0], nil
+}
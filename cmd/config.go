@@ -1,14 +1,11 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
-	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -22,20 +19,14 @@ type item struct {
 	title, desc string
 }
 
-type OllamaModel struct {
-	Name string `json:"name"`
-}
-
-type OllamaResponse struct {
-	Models []OllamaModel `json:"models"`
-}
-
 func (i item) Title() string       { return i.title }
 func (i item) Description() string { return i.desc }
 func (i item) FilterValue() string { return i.title }
 
 var toggleChoices = []string{"Enable", "Disable"}
 
+const customModelTitle = "Custom model..."
+
 type configModel struct {
 	mainMenuList       list.Model
 	textInput          textinput.Model
@@ -44,10 +35,14 @@ type configModel struct {
 	currentStep        int
 	selectedProvider   string
 	selectedLLM        string
+	configuringEmbeds  bool
+	embeddingsProvider string
+	embeddingsModel    string
 	apiKeyRequired     bool
 	accountID          string
 	settings           []string
 	providerList       list.Model
+	embeddingsList     list.Model
 	llmList            list.Model
 	toggleConfirmation list.Model
 	currentList        *list.Model
@@ -61,11 +56,16 @@ const (
 	StepEnterAPIKey
 	StepEnterAccountID
 	StepToggleConfirmation
+	StepEnterBaseURL
+	StepEnterModel
+	StepSelectEmbeddingsProvider
+	StepEnterEmbeddingsModel
 )
 
 func initialModel() configModel {
 	mainMenuItems := []list.Item{
 		item{title: "Configure Provider and API Key", desc: "Select provider, LLM, and configure API Key"},
+		item{title: "Configure Embeddings Provider", desc: "Select the provider and model used by the semantic cache"},
 		item{title: "Toggle Command Confirmation", desc: "Enable/Disable command confirmation"},
 		item{title: "Advanced Settings", desc: "LLM and vector index settings"},
 		item{title: "View Current Configuration", desc: "Display current settings"},
@@ -91,9 +91,8 @@ func initialModel() configModel {
 		selectedLLM = "claude-3-5-sonnet-20240620"
 	}
 
-	providerChoices := []string{"Cloudflare", "Anthropic", "OpenAI", "Ollama"}
 	providerItems := []list.Item{}
-	for _, provider := range providerChoices {
+	for _, provider := range chatProviderNames() {
 		providerItems = append(providerItems, item{title: provider})
 	}
 	providerList := list.New(providerItems, list.NewDefaultDelegate(), 0, 0)
@@ -102,6 +101,16 @@ func initialModel() configModel {
 	providerList.SetFilteringEnabled(false)
 	providerList.SetShowHelp(false)
 
+	embeddingsItems := []list.Item{}
+	for _, provider := range embeddingProviderNames() {
+		embeddingsItems = append(embeddingsItems, item{title: provider})
+	}
+	embeddingsList := list.New(embeddingsItems, list.NewDefaultDelegate(), 0, 0)
+	embeddingsList.Title = "Select Embeddings Provider"
+	embeddingsList.SetShowStatusBar(false)
+	embeddingsList.SetFilteringEnabled(false)
+	embeddingsList.SetShowHelp(false)
+
 	toggleItems := []list.Item{
 		item{title: "Enable"},
 		item{title: "Disable"},
@@ -124,9 +133,12 @@ func initialModel() configModel {
 		currentStep:        StepNone,
 		selectedProvider:   selectedProvider,
 		selectedLLM:        selectedLLM,
-		accountID:          viper.GetString("cloudflare_account_id"),
+		embeddingsProvider: embeddingsProviderName(),
+		embeddingsModel:    viper.GetString("embeddings_model"),
+		accountID:          getAccountID(selectedProvider),
 		settings:           []string{"temperature", "max_tokens", "vector_size", "k", "max_distance", "embeddings_provider", "embeddings_model"},
 		providerList:       providerList,
+		embeddingsList:     embeddingsList,
 		llmList:            llmList,
 		toggleConfirmation: toggleList,
 		activeList:         &mainMenuList,
@@ -159,16 +171,50 @@ func (m *configModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.providerList, cmd = m.providerList.Update(msg)
 			cmds = append(cmds, cmd)
 			if msg.Type == tea.KeyEnter {
-				m.handleListSelection(&m.providerList, &m.selectedProvider, StepSelectLLM)
-				m.llmList = createLLMList(m.selectedProvider)
-				m.activeList = &m.llmList
+				if m.handleListSelection(&m.providerList, &m.selectedProvider, StepSelectLLM) {
+					m.configuringEmbeds = false
+					if requiresBaseURL(m.selectedProvider) {
+						m.currentStep = StepEnterBaseURL
+						m.textInput.Placeholder = fmt.Sprintf("Enter %s %s", m.selectedProvider, baseURLLabel(m.selectedProvider))
+						m.textInput.SetValue(getBaseURL(m.selectedProvider))
+						m.textInput.CursorEnd()
+						m.textInput.Focus()
+					} else {
+						m.showLLMList()
+					}
+				}
 			}
 		case StepSelectLLM:
+			filtering := m.llmList.FilterState() != list.Unfiltered
+			if msg.Type == tea.KeyEnter && m.llmList.SettingFilter() && len(m.llmList.VisibleItems()) == 0 {
+				if model := strings.TrimSpace(m.llmList.FilterValue()); model != "" {
+					m.selectedLLM = model
+					return m.handleLLMSelection()
+				}
+			}
 			m.llmList, cmd = m.llmList.Update(msg)
 			cmds = append(cmds, cmd)
 			if msg.Type == tea.KeyEnter {
-				m.handleListSelection(&m.llmList, &m.selectedLLM, StepEnterAccountID)
-				return m.handleLLMSelection()
+				return m.selectLLM()
+			}
+			if msg.Type == tea.KeyEsc && filtering {
+				return m, tea.Batch(cmds...)
+			}
+		case StepSelectEmbeddingsProvider:
+			m.embeddingsList, cmd = m.embeddingsList.Update(msg)
+			cmds = append(cmds, cmd)
+			if msg.Type == tea.KeyEnter {
+				if m.handleListSelection(&m.embeddingsList, &m.embeddingsProvider, StepEnterEmbeddingsModel) {
+					m.configuringEmbeds = true
+					if requiresBaseURL(m.embeddingsProvider) && getBaseURL(m.embeddingsProvider) == "" {
+						m.currentStep = StepEnterBaseURL
+						m.textInput.Placeholder = fmt.Sprintf("Enter %s %s", m.embeddingsProvider, baseURLLabel(m.embeddingsProvider))
+						m.textInput.SetValue("")
+						m.textInput.Focus()
+					} else {
+						m.promptEmbeddingsModel()
+					}
+				}
 			}
 		case StepToggleConfirmation:
 			m.toggleConfirmation, cmd = m.toggleConfirmation.Update(msg)
@@ -178,10 +224,10 @@ func (m *configModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.currentStep = StepNone
 				m.activeList = &m.mainMenuList
 			}
-		case StepEnterAccountID, StepEnterAPIKey:
+		case StepEnterAccountID, StepEnterAPIKey, StepEnterBaseURL, StepEnterModel, StepEnterEmbeddingsModel:
 			m.textInput, cmd = m.textInput.Update(msg)
 			cmds = append(cmds, cmd)
-			if m.handleTextInput(msg) {
+			if m.handleTextInput(msg) && m.currentStep == StepNone {
 				m.activeList = &m.mainMenuList
 			}
 		}
@@ -191,9 +237,14 @@ func (m *configModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.activeList = &m.mainMenuList
 		}
 
+	case list.FilterMatchesMsg:
+		m.llmList, cmd = m.llmList.Update(msg)
+		cmds = append(cmds, cmd)
+
 	case tea.WindowSizeMsg:
 		m.mainMenuList.SetSize(msg.Width, msg.Height-4)
 		m.providerList.SetSize(msg.Width, msg.Height-4)
+		m.embeddingsList.SetSize(msg.Width, msg.Height-4)
 		m.llmList.SetSize(msg.Width, msg.Height-4)
 		m.toggleConfirmation.SetSize(msg.Width, msg.Height-4)
 	}
@@ -221,6 +272,9 @@ func (m *configModel) handleMainMenuSelection() (tea.Model, tea.Cmd) {
 		case "Configure Provider and API Key":
 			m.currentStep = StepSelectProvider
 			m.activeList = &m.providerList
+		case "Configure Embeddings Provider":
+			m.currentStep = StepSelectEmbeddingsProvider
+			m.activeList = &m.embeddingsList
 		case "Toggle Command Confirmation":
 			m.currentStep = StepToggleConfirmation
 			m.activeList = &m.toggleConfirmation
@@ -234,6 +288,11 @@ func (m *configModel) handleMainMenuSelection() (tea.Model, tea.Cmd) {
 			apiKey := getAPIKey(m.selectedProvider)
 			m.statusMessage = fmt.Sprintf("Provider: %s\nModel: %s\nAPI Key: %s\nRequire Confirmation: %v",
 				m.selectedProvider, m.selectedLLM, maskAPIKey(apiKey), viper.GetBool("require_confirmation"))
+			if requiresBaseURL(m.selectedProvider) {
+				m.statusMessage += fmt.Sprintf("\n%s: %s", capitalize(baseURLLabel(m.selectedProvider)), getBaseURL(m.selectedProvider))
+			}
+			m.statusMessage += fmt.Sprintf("\nEmbeddings Provider: %s\nEmbeddings Model: %s",
+				m.embeddingsProvider, embeddingsModelName(m.embeddingsProvider))
 		case "Save and Exit":
 			err := saveConfig()
 			if err != nil {
@@ -252,21 +311,74 @@ func (m *configModel) handleMainMenuSelection() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m *configModel) showLLMList() {
+	m.llmList = createLLMList(m.selectedProvider)
+	if len(m.llmList.Items()) > 1 {
+		m.llmList.SetSize(m.providerList.Width(), m.providerList.Height())
+		m.currentStep = StepSelectLLM
+		m.activeList = &m.llmList
+		return
+	}
+	m.promptModel()
+}
+
+func (m *configModel) promptModel() {
+	m.currentStep = StepEnterModel
+	m.textInput.Placeholder = fmt.Sprintf("Enter %s model name", m.selectedProvider)
+	m.textInput.SetValue("")
+	m.textInput.Focus()
+}
+
+func (m *configModel) selectLLM() (tea.Model, tea.Cmd) {
+	selected, ok := m.llmList.SelectedItem().(item)
+	if !ok {
+		return m, nil
+	}
+	if selected.title == customModelTitle {
+		m.promptModel()
+		return m, nil
+	}
+	m.selectedLLM = selected.title
+	return m.handleLLMSelection()
+}
+
+func (m *configModel) promptEmbeddingsModel() {
+	m.currentStep = StepEnterEmbeddingsModel
+	m.textInput.Placeholder = fmt.Sprintf("Enter %s embeddings model", m.embeddingsProvider)
+	m.textInput.SetValue(embeddingsModelName(m.embeddingsProvider))
+	m.textInput.CursorEnd()
+	m.textInput.Focus()
+}
+
+// credentialsProvider is the provider whose account ID and API key are
+// being entered: the embeddings provider or the chat provider.
+func (m *configModel) credentialsProvider() string {
+	if m.configuringEmbeds {
+		return m.embeddingsProvider
+	}
+	return m.selectedProvider
+}
+
 func (m *configModel) handleLLMSelection() (tea.Model, tea.Cmd) {
-	if m.selectedProvider == "Cloudflare" {
+	provider := m.credentialsProvider()
+	if requiresAccountID(provider) {
+		m.accountID = getAccountID(provider)
 		m.currentStep = StepEnterAccountID
-		m.textInput.Placeholder = "Enter Cloudflare Account ID"
+		m.textInput.Placeholder = fmt.Sprintf("Enter %s Account ID", provider)
 		m.textInput.SetValue(m.accountID)
 		m.textInput.CursorEnd()
 		m.textInput.Focus()
-	} else if !apiKeyAvailable(m.selectedProvider) {
+	} else if !apiKeyAvailable(provider) {
 		m.apiKeyRequired = true
 		m.currentStep = StepEnterAPIKey
-		existingAPIKey := getAPIKey(m.selectedProvider)
+		existingAPIKey := getAPIKey(provider)
 		if existingAPIKey != "" {
 			maskedAPIKey := maskAPIKey(existingAPIKey)
 			m.textInput.SetValue(maskedAPIKey)
 			m.textInput.CursorEnd()
+		} else if optionalAPIKey(provider) {
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = "Enter API Key (leave empty if not required)"
 		} else {
 			m.textInput.Placeholder = "Enter API Key"
 		}
@@ -274,13 +386,29 @@ func (m *configModel) handleLLMSelection() (tea.Model, tea.Cmd) {
 	} else {
 		m.apiKeyRequired = false
 		m.currentStep = StepNone
-		m.statusMessage = "Provider and LLM configured."
-		viper.Set("provider", m.selectedProvider)
-		viper.Set("model", m.selectedLLM)
+		m.finishProviderSelection("")
 	}
 	return m, nil
 }
 
+func (m *configModel) finishProviderSelection(prefix string) {
+	if m.configuringEmbeds {
+		m.statusMessage = prefix + "Embeddings provider configured."
+		viper.Set("embeddings_provider", m.embeddingsProvider)
+		viper.Set("embeddings_model", m.embeddingsModel)
+		if m.embeddingsProvider == azureProviderName {
+			saveAzureDeployment(m.embeddingsModel, true)
+		}
+		return
+	}
+	m.statusMessage = prefix + "Provider and LLM configured."
+	viper.Set("provider", m.selectedProvider)
+	viper.Set("model", m.selectedLLM)
+	if m.selectedProvider == azureProviderName {
+		saveAzureDeployment(m.selectedLLM, false)
+	}
+}
+
 func (m *configModel) handleToggleConfirmationSelection() bool {
 	if m.toggleConfirmation.SelectedItem() != nil {
 		m.toggleConfirmation.SetShowStatusBar(false)
@@ -304,25 +432,41 @@ func (m *configModel) handleTextInput(msg tea.KeyMsg) bool {
 	switch msg.Type {
 	case tea.KeyEnter:
 		switch m.currentStep {
+		case StepEnterBaseURL:
+			saveBaseURL(m.credentialsProvider(), strings.TrimSpace(m.textInput.Value()))
+			m.textInput.SetValue("")
+			if m.configuringEmbeds {
+				m.promptEmbeddingsModel()
+			} else {
+				m.showLLMList()
+			}
+		case StepEnterModel:
+			model := strings.TrimSpace(m.textInput.Value())
+			if model == "" {
+				return false
+			}
+			m.selectedLLM = model
+			m.textInput.SetValue("")
+			m.handleLLMSelection()
+		case StepEnterEmbeddingsModel:
+			m.embeddingsModel = strings.TrimSpace(m.textInput.Value())
+			m.textInput.SetValue("")
+			m.handleLLMSelection()
 		case StepEnterAccountID:
 			m.accountID = m.textInput.Value()
-			if m.accountID != "" {
-				viper.Set("cloudflare_account_id", m.accountID)
-			}
+			saveAPIKey(m.credentialsProvider(), "", m.accountID)
 			m.textInput.SetValue("")
 			m.textInput.Placeholder = "Enter API Key"
 			m.currentStep = StepEnterAPIKey
 		case StepEnterAPIKey:
 			apiKey := m.textInput.Value()
 			if apiKey != "" {
-				saveAPIKey(m.selectedProvider, apiKey, m.accountID)
+				saveAPIKey(m.credentialsProvider(), apiKey, m.accountID)
 			}
 			m.apiKeyRequired = false
 			m.currentStep = StepNone
 			m.textInput.Blur()
-			m.statusMessage = "API Key saved. Provider and LLM configured."
-			viper.Set("provider", m.selectedProvider)
-			viper.Set("model", m.selectedLLM)
+			m.finishProviderSelection("API Key saved. ")
 		}
 		return true
 	case tea.KeyEsc:
@@ -349,12 +493,15 @@ func (m configModel) View() string {
 		content = m.providerList.View()
 	case StepSelectLLM:
 		content = m.llmList.View()
+		footer = "(Type / to filter, Enter to select, Esc to cancel)"
+	case StepSelectEmbeddingsProvider:
+		content = m.embeddingsList.View()
 	case StepToggleConfirmation:
 		content = m.toggleConfirmation.View()
 	case StepEnterAccountID:
 		content = lipgloss.NewStyle().Margin(1, 0, 1, 4).Render(m.textInput.View())
 		footer = "(Press Enter to confirm, Esc to cancel)"
-	case StepEnterAPIKey:
+	case StepEnterAPIKey, StepEnterBaseURL, StepEnterModel, StepEnterEmbeddingsModel:
 		content = lipgloss.NewStyle().Margin(1, 0, 1, 4).Render(m.textInput.View())
 		footer = "(Press Enter to confirm, Esc to cancel)"
 	}
@@ -393,10 +540,11 @@ func createLLMList(provider string) list.Model {
 	for _, llm := range getLLMsForProvider(provider) {
 		llmItems = append(llmItems, item{title: llm})
 	}
+	llmItems = append(llmItems, item{title: customModelTitle, desc: "Enter any model id"})
 	llmList := list.New(llmItems, list.NewDefaultDelegate(), 0, 0)
 	llmList.Title = "Select LLM"
 	llmList.SetShowStatusBar(false)
-	llmList.SetFilteringEnabled(false)
+	llmList.SetFilteringEnabled(true)
 	llmList.SetShowHelp(false)
 	llmList.SetWidth(30)
 	return llmList
@@ -436,108 +584,23 @@ func configMenu() {
 }
 
 func getLLMsForProvider(provider string) []string {
-	switch provider {
-	case "Anthropic":
-		return []string{"claude-3-5-sonnet-20240620"}
-	case "OpenAI":
-		return []string{"gpt-4o", "gpt-4o-mini"}
-	case "Cloudflare":
-		return []string{"@cf/meta/llama-3.1-8b-instruct"}
-	case "Ollama":
-		models, err := getOllamaModels()
-		if err != nil {
-			fmt.Printf("Error fetching Ollama models: %v\n", err)
-			return []string{}
-		}
-		return models
-	default:
+	p, err := getProvider(provider)
+	if err != nil {
 		return []string{}
 	}
-}
-
-func apiKeyAvailable(provider string) bool {
-	switch provider {
-	case "Anthropic":
-		return os.Getenv("ANTHROPIC_API_KEY") != ""
-	case "OpenAI":
-		return os.Getenv("OPENAI_API_KEY") != ""
-	case "Cloudflare":
-		return os.Getenv("CLOUDFLARE_API_KEY") != ""
-	case "Ollama":
-		return isOllamaAvailable()
-	default:
-		return false
-	}
-}
-
-func saveAPIKey(provider string, apiKey string, accountID string) {
-	switch provider {
-	case "Anthropic":
-		if apiKey != "" {
-			viper.Set("api_keys.anthropic", apiKey)
-		}
-	case "OpenAI":
-		if apiKey != "" {
-			viper.Set("api_keys.openai", apiKey)
-		}
-	case "Cloudflare":
-		if apiKey != "" {
-			viper.Set("api_keys.cloudflare", apiKey)
-		}
-		if accountID != "" {
-			viper.Set("cloudflare_account_id", accountID)
-		}
-	}
-}
-
-func getAPIKey(provider string) string {
-	var key string
-	switch provider {
-	case "Anthropic":
-		key = viper.GetString("api_keys.anthropic")
-		if key == "" {
-			key = os.Getenv("ANTHROPIC_API_KEY")
-		}
-	case "OpenAI":
-		key = viper.GetString("api_keys.openai")
-		if key == "" {
-			key = os.Getenv("OPENAI_API_KEY")
-		}
-	case "Cloudflare":
-		key = viper.GetString("api_keys.cloudflare")
-		if key == "" {
-			key = os.Getenv("CLOUDFLARE_API_KEY")
-		}
-	case "Ollama":
-		key = "ollama_key_placeholder"
-	}
-	return key
-}
-
-func isOllamaAvailable() bool {
-	client := &http.Client{Timeout: 2 * time.Second}
-	_, err := client.Get("http://localhost:11434/api/tags")
-	return err == nil
-}
-
-func getOllamaModels() ([]string, error) {
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get("http://localhost:11434/api/tags")
+	models, err := p.ListModels()
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var ollamaResp OllamaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
-		return nil, err
+		fmt.Printf("Error fetching %s models: %v\n", provider, err)
+		return []string{}
 	}
+	return models
+}
 
-	var models []string
-	for _, model := range ollamaResp.Models {
-		models = append(models, model.Name)
+func capitalize(s string) string {
+	if s == "" {
+		return s
 	}
-	return models, nil
+	return strings.ToUpper(s[:1]) + s[1:]
 }
 
 func maskAPIKey(key string) string {
@@ -2,11 +2,12 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/xml"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -19,51 +20,111 @@ const (
 	EmbeddingsRequest
 )
 
-func executeCommand(textCommand string) {
-	cachedResponse, found, vector := getCachedResponse(textCommand)
+// commandWaitDelay is how long a command has to exit after Ctrl-C.
+const commandWaitDelay = 3 * time.Second
+
+func executeCommand(ctx context.Context, textCommand string) {
+	cachedResponse, found, vector := getCachedResponse(ctx, textCommand)
+	if ctx.Err() != nil {
+		return
+	}
 	if found {
 		fmt.Println("Cached command:", cachedResponse)
-		err := executeCLICommand(cachedResponse)
-		if err != nil {
+		err := executeCLICommand(ctx, cachedResponse)
+		if err != nil && ctx.Err() == nil {
 			fmt.Println("Error executing cached command:", err)
 		}
 		return
 	}
 
-	provider := viper.GetString("provider")
-	model := viper.GetString("model")
-	apiKey := getAPIKey(provider)
-	if apiKey == "" {
-		fmt.Printf("Error: API key not set for provider %s. Use 'ai config' or set the appropriate environment variable.\n", provider)
-		os.Exit(1)
+	systemPrompt, err := systemPromptFor(viper.GetString("provider"))
+	if err != nil {
+		fmt.Println(err)
+		exit(1)
 	}
-
+	ctx = withCommandPrompt(ctx, systemPrompt)
+	candidates := viper.GetInt("candidates")
 	messages := []AIMessage{
 		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: textCommand},
+		{Role: "user", Content: candidatePrompt(textCommand, candidates)},
 	}
 
 	maxAttempts := maxRetries
 	attempts := 0
 
 	for attempts < maxAttempts {
-		responseText, err := callAPI[string](provider, model, apiKey, messages, LLMRequest)
+		renderer := newCommandRenderer(os.Stdout)
+		onDelta := renderer.Write
+		if candidates > 1 {
+			fmt.Printf("Generating %d candidate commands...\n", candidates)
+			onDelta = func(string) {}
+		}
+		var responseText string
+		var entry ChainEntry
+		var err error
+		if hedgingEnabled() {
+			responseText, entry, err = callHedged(ctx, messages, &commandsOutput)
+		} else {
+			responseText, entry, err = callWithFallback(ctx, messages, &commandsOutput, onDelta)
+		}
+		renderer.Finish()
 
 		if err != nil {
-			fmt.Printf("Error calling %s API: %v\n", provider, err)
-			os.Exit(1)
+			fmt.Println(describeAPIError(entry.Provider, err))
+			if ctx.Err() != nil {
+				return
+			}
+			exit(1)
 		}
 
-		var cmd Command
-		err = xml.Unmarshal([]byte(responseText), &cmd)
-		if err != nil || cmd.Content == "" {
-			fmt.Printf("Error parsing LLM response: %v\nRaw response: %s\n", err, responseText)
-			os.Exit(1)
+		commands, err := parseCommands(responseText)
+		if err != nil {
+			attempts++
+			if attempts >= maxAttempts {
+				fmt.Printf("Error parsing LLM response: %v\nRaw response: %s\n", err, responseText)
+				exit(1)
+			}
+			fmt.Println("Could not find a command in the response. Asking the model to reformat it...")
+			messages = append(messages, AIMessage{Role: "assistant", Content: responseText})
+			messages = append(messages, AIMessage{Role: "user", Content: reformatPrompt})
+			continue
+		}
+		commands = withoutRejected(textCommand, commands)
+		cmd := commands[0]
+		if len(commands) > 1 {
+			choice, err := pickCommand(ctx, commands)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				fmt.Printf("Could not show the command picker (%v); using the first command.\n", err)
+				choice = 0
+			}
+			if choice < 0 {
+				fmt.Println("Command execution cancelled.")
+				return
+			}
+			cmd = commands[choice]
+			var rejected []string
+			for i, other := range commands {
+				if i != choice {
+					rejected = append(rejected, other.Content)
+				}
+			}
+			if err := addRejected(textCommand, rejected); err != nil {
+				fmt.Println("Failed to remember rejected commands:", err)
+			}
 		}
 
-		fmt.Println("Generated command:", cmd.Content)
+		if !renderer.Rendered(cmd.Content) {
+			fmt.Println("Generated command:", cmd.Content)
+		}
+		printCommandDetails(cmd)
 
-		err = executeCLICommand(cmd.Content)
+		err = executeCLICommand(ctx, cmd.Content)
+		if ctx.Err() != nil {
+			return
+		}
 		if err == nil {
 			addToVecDB(vector, textCommand, cmd.Content)
 			break
@@ -80,21 +141,43 @@ func executeCommand(textCommand string) {
 	}
 }
 
-func confirmExecution() bool {
+func confirmExecution(ctx context.Context, command string) bool {
 	requireConfirmation := viper.GetBool("require_confirmation")
 	if !requireConfirmation {
 		return true
 	}
 
+	if viper.GetBool("explain_before_confirm") {
+		explanation, err := explainCommand(ctx, command)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			fmt.Println("Could not explain the command:", err)
+		} else {
+			printExplanation(explanation)
+		}
+	}
+
 	fmt.Print("Do you want to execute this command? (y/n): ")
-	var response string
-	fmt.Scanln(&response)
-	return strings.ToLower(response) == "y" || strings.ToLower(response) == "yes"
+	answer := make(chan string, 1)
+	go func() {
+		var response string
+		fmt.Scanln(&response)
+		answer <- response
+	}()
+	select {
+	case <-ctx.Done():
+		fmt.Println()
+		return false
+	case response := <-answer:
+		return strings.ToLower(response) == "y" || strings.ToLower(response) == "yes"
+	}
 }
 
-func executeCLICommand(command string) error {
+func executeCLICommand(ctx context.Context, command string) error {
 	if viper.GetBool("require_confirmation") {
-		if !confirmExecution() {
+		if !confirmExecution(ctx, command) {
 			fmt.Println("Command execution cancelled.")
 			return nil
 		}
@@ -109,7 +192,11 @@ func executeCLICommand(command string) error {
 		return nil
 	}
 
-	execCmd := exec.Command("sh", "-c", command)
+	execCmd := exec.CommandContext(ctx, commandShell(), "-c", command)
+	// The terminal already delivers Ctrl-C to the command, so cancelling
+	// only waits for it to exit, killing it if it ignores the signal.
+	execCmd.Cancel = func() error { return nil }
+	execCmd.WaitDelay = commandWaitDelay
 	var stderr bytes.Buffer
 	execCmd.Stdout = os.Stdout
 	execCmd.Stderr = &stderr
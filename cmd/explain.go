@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+type CommandPart struct {
+	Text        string `json:"text"`
+	Kind        string `json:"kind"`
+	Explanation string `json:"explanation"`
+	Destructive bool   `json:"destructive"`
+}
+
+type CommandExplanation struct {
+	Summary     string        `json:"summary"`
+	Parts       []CommandPart `json:"parts"`
+	Destructive bool          `json:"destructive"`
+	Warnings    []string      `json:"warnings"`
+}
+
+var explanationSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"summary": map[string]interface{}{
+			"type":        "string",
+			"description": "One or two sentences on what the whole command does.",
+		},
+		"parts": map[string]interface{}{
+			"type":        "array",
+			"description": "Every part of the command, in order.",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text": map[string]interface{}{
+						"type":        "string",
+						"description": "The part exactly as written in the command.",
+					},
+					"kind": map[string]interface{}{
+						"type": "string",
+						"enum": []string{"program", "subcommand", "flag", "argument", "pipe", "redirection", "operator", "variable", "substitution"},
+					},
+					"explanation": map[string]interface{}{
+						"type":        "string",
+						"description": "What this part does here.",
+					},
+					"destructive": map[string]interface{}{
+						"type":        "boolean",
+						"description": "Whether this part deletes, overwrites or irreversibly changes data or system state.",
+					},
+				},
+				"required":             []string{"text", "kind", "explanation", "destructive"},
+				"additionalProperties": false,
+			},
+		},
+		"destructive": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Whether running the command can destroy data or change system state irreversibly.",
+		},
+		"warnings": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Risks worth knowing before running the command.",
+		},
+	},
+	"required":             []string{"summary", "parts", "destructive", "warnings"},
+	"additionalProperties": false,
+}
+
+var explanationOutput = StructuredOutput{
+	Name:        "explain_command",
+	Description: "Explain a shell command part by part.",
+	Schema:      explanationSchema,
+}
+
+var destructiveStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true)
+
+func explainPrompt() string {
+	schema, _ := json.Marshal(explanationSchema)
+	return fmt.Sprintf("Explain the shell command given by the user, as run on %s. Break it into its parts in order: the program, subcommands, each flag and argument, pipes, redirections and operators. Mark every part that deletes, overwrites or irreversibly changes data or system state as destructive. Reply with only a JSON object matching this JSON schema: %s", osInfo, schema)
+}
+
+func explainCommand(ctx context.Context, command string) (CommandExplanation, error) {
+	var explanation CommandExplanation
+	messages := []AIMessage{
+		{Role: "system", Content: explainPrompt()},
+		{Role: "user", Content: command},
+	}
+	text, entry, err := callWithFallback(ctx, messages, &explanationOutput, func(string) {})
+	if err != nil {
+		return explanation, fmt.Errorf("%s", describeAPIError(entry.Provider, err))
+	}
+	if err := json.Unmarshal([]byte(jsonObject(text)), &explanation); err != nil {
+		return explanation, fmt.Errorf("Error parsing explanation: %v\nRaw response: %s", err, text)
+	}
+	return explanation, nil
+}
+
+// jsonObject returns the outermost JSON object in a reply, dropping any
+// code fence or prose around it.
+func jsonObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
+
+func printExplanation(explanation CommandExplanation) {
+	if explanation.Summary != "" {
+		fmt.Println(explanation.Summary)
+		fmt.Println()
+	}
+
+	textWidth, kindWidth := 0, 0
+	for _, part := range explanation.Parts {
+		textWidth = max(textWidth, len(part.Text))
+		kindWidth = max(kindWidth, len(part.Kind))
+	}
+	for _, part := range explanation.Parts {
+		line := fmt.Sprintf("  %-*s  %-*s  %s", textWidth, part.Text, kindWidth, part.Kind, part.Explanation)
+		if part.Destructive {
+			line = destructiveStyle.Render("! " + strings.TrimPrefix(line, "  "))
+		}
+		fmt.Println(line)
+	}
+
+	if explanation.Destructive {
+		fmt.Println()
+		fmt.Println(destructiveStyle.Render("This command is destructive."))
+	}
+	for _, warning := range explanation.Warnings {
+		fmt.Println("Warning:", warning)
+	}
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [flags] [--] <command>",
+	Short: "Explain what a shell command does",
+	Long:  `Break a shell command down into its program, flags, arguments, pipes and redirections, and flag the parts that are destructive.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeStore()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		explanation, err := explainCommand(ctx, strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		printExplanation(explanation)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	// Flags are only read before the command, so its own flags, as in
+	// "ai explain ls -la", are part of the command to explain.
+	explainCmd.Flags().SetInterspersed(false)
+}
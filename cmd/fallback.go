@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var ErrMissingAPIKey = errors.New("API key not set")
+
+type ChainEntry struct {
+	Provider string `mapstructure:"provider"`
+	Model    string `mapstructure:"model"`
+}
+
+type circuitState struct {
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"open_until"`
+}
+
+// circuitBreaker remembers recently failing providers across invocations so
+// the fallback chain can skip them until their cooldown has passed.
+type circuitBreaker struct {
+	path    string
+	state   map[string]*circuitState
+	changed bool
+}
+
+// providerChain returns the configured provider followed by the entries of
+// the fallback list, in order.
+func providerChain() []ChainEntry {
+	chain := []ChainEntry{{Provider: viper.GetString("provider"), Model: viper.GetString("model")}}
+	var fallbacks []ChainEntry
+	if err := viper.UnmarshalKey("fallback", &fallbacks); err != nil {
+		fmt.Printf("Ignoring invalid fallback configuration: %v\n", err)
+		return chain
+	}
+	for _, entry := range fallbacks {
+		if entry.Provider != "" && entry != chain[0] {
+			chain = append(chain, entry)
+		}
+	}
+	return chain
+}
+
+func callWithFallback(ctx context.Context, messages []AIMessage, output *StructuredOutput, onDelta func(string)) (string, ChainEntry, error) {
+	chain, err := budgetChain(providerChain())
+	if err != nil {
+		return "", chain[0], err
+	}
+	breaker := loadCircuitBreaker()
+	defer breaker.save()
+
+	candidates := []ChainEntry{}
+	for _, entry := range chain {
+		if breaker.allow(entry.Provider) {
+			candidates = append(candidates, entry)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = chain
+	}
+
+	var lastErr error
+	for i, entry := range candidates {
+		apiKey := getAPIKey(entry.Provider)
+		if apiKey == "" && requiresAPIKey(entry.Provider) {
+			lastErr = ErrMissingAPIKey
+		} else {
+			text, err := callStreamingAPI(ctx, entry.Provider, entry.Model, apiKey, messages, output, onDelta)
+			if err == nil {
+				breaker.recordSuccess(entry.Provider)
+				return text, entry, nil
+			}
+			lastErr = err
+			if ctx.Err() != nil || !shouldFallback(err) {
+				return "", entry, err
+			}
+			breaker.recordFailure(entry.Provider)
+		}
+		if i < len(candidates)-1 {
+			fmt.Printf("%s Falling back to %s.\n", describeAPIError(entry.Provider, lastErr), candidates[i+1].Provider)
+		} else {
+			return "", entry, lastErr
+		}
+	}
+	return "", chain[0], lastErr
+}
+
+func shouldFallback(err error) bool {
+	return errors.Is(err, ErrServerError) ||
+		errors.Is(err, ErrNetwork) ||
+		errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrAuthFailed) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+func loadCircuitBreaker() *circuitBreaker {
+	cb := &circuitBreaker{
+		path:  filepath.Join(storeDir, circuitFileName),
+		state: map[string]*circuitState{},
+	}
+	data, err := os.ReadFile(cb.path)
+	if err == nil {
+		json.Unmarshal(data, &cb.state)
+	}
+	return cb
+}
+
+func (cb *circuitBreaker) allow(provider string) bool {
+	state, ok := cb.state[provider]
+	return !ok || time.Now().After(state.OpenUntil)
+}
+
+func (cb *circuitBreaker) recordFailure(provider string) {
+	state, ok := cb.state[provider]
+	if !ok {
+		state = &circuitState{}
+		cb.state[provider] = state
+	}
+	state.Failures++
+	threshold := viper.GetInt("circuit_breaker.failure_threshold")
+	if threshold < 1 {
+		threshold = 1
+	}
+	if state.Failures >= threshold {
+		state.OpenUntil = time.Now().Add(viper.GetDuration("circuit_breaker.cooldown"))
+	}
+	cb.changed = true
+}
+
+func (cb *circuitBreaker) recordSuccess(provider string) {
+	if _, ok := cb.state[provider]; ok {
+		delete(cb.state, provider)
+		cb.changed = true
+	}
+}
+
+func (cb *circuitBreaker) save() {
+	if !cb.changed {
+		return
+	}
+	data, err := json.MarshalIndent(cb.state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(cb.path, data, 0644); err != nil {
+		fmt.Printf("Failed to save circuit breaker state: %v\n", err)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// useTempStore points the store directory at a temporary one, so circuit
+// breaker state, usage and rules files do not touch the real config.
+func useTempStore(t *testing.T) {
+	t.Helper()
+	saved := storeDir
+	storeDir = t.TempDir()
+	t.Cleanup(func() {
+		storeDir = saved
+		viper.Reset()
+	})
+}
+
+func TestOllamaOutageFallsBack(t *testing.T) {
+	useTempStore(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	viper.Set("provider", "Ollama")
+	viper.Set("model", "llama3.1")
+	viper.Set("ollama.base_url", down.URL)
+	viper.Set("fallback", []map[string]interface{}{{"provider": "Local Rules"}})
+	viper.Set("circuit_breaker.failure_threshold", 3)
+
+	messages := []AIMessage{
+		{Role: "system", Content: "Translate the request."},
+		{Role: "user", Content: "list files"},
+	}
+	text, entry, err := callWithFallback(context.Background(), messages, nil, func(string) {})
+	if err != nil {
+		t.Fatalf("callWithFallback: %v", err)
+	}
+	if entry.Provider != "Local Rules" {
+		t.Errorf("answered by %q, want Local Rules", entry.Provider)
+	}
+	if commands, err := parseCommands(text); err != nil || commands[0].Content != "ls -la ." {
+		t.Errorf("reply %q, want the command ls -la .", text)
+	}
+
+	breaker := loadCircuitBreaker()
+	if state, ok := breaker.state["Ollama"]; !ok || state.Failures != 1 {
+		t.Errorf("circuit breaker state for Ollama = %+v, want one failure", state)
+	}
+}
+
+func TestGetJSONErrorKinds(t *testing.T) {
+	useTempStore(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var out struct{}
+	if err := getJSON(context.Background(), server.URL, nil, &out); !shouldFallback(err) {
+		t.Errorf("503 from getJSON: %v, want a server error", err)
+	}
+	server.Close()
+	if err := getJSON(context.Background(), server.URL, nil, &out); !shouldFallback(err) {
+		t.Errorf("unreachable server from getJSON: %v, want a network error", err)
+	}
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	packageManagers = []string{"brew", "port", "nix", "apt", "dnf", "yum", "pacman", "zypper", "apk", "winget", "choco", "scoop"}
+	versionPattern  = regexp.MustCompile(`\d+(\.\d+)+`)
+)
+
+// Fingerprint describes the machine commands will run on, so the model can
+// pick the right flags and tools. It is cached in the store directory and
+// collected again when PATH, the shell or the OS changes.
+type Fingerprint struct {
+	Key            string    `json:"key"`
+	Collected      time.Time `json:"collected"`
+	OS             string    `json:"os"`
+	Arch           string    `json:"arch"`
+	Distro         string    `json:"distro"`
+	Kernel         string    `json:"kernel"`
+	Shell          string    `json:"shell"`
+	ShellVersion   string    `json:"shell_version"`
+	PackageManager string    `json:"package_manager"`
+	Coreutils      string    `json:"coreutils"`
+	Tools          []string  `json:"tools"`
+}
+
+// Summary is the one-line description of the environment used in the
+// default prompt.
+func (f Fingerprint) Summary() string {
+	var parts []string
+	if f.Distro != "" {
+		parts = append(parts, f.Distro)
+	}
+	if f.Kernel != "" {
+		parts = append(parts, "kernel "+f.Kernel)
+	}
+	if f.Shell != "" {
+		parts = append(parts, strings.TrimSpace(f.Shell+" "+f.ShellVersion))
+	}
+	if f.PackageManager != "" {
+		parts = append(parts, "package manager "+f.PackageManager)
+	}
+	if f.Coreutils != "" {
+		parts = append(parts, f.Coreutils+" coreutils")
+	}
+	if len(f.Tools) > 0 {
+		parts = append(parts, "installed tools: "+strings.Join(f.Tools, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// fingerprintKey changes whenever the cached fingerprint may be out of
+// date: a different OS release or kernel, PATH, shell or tool list.
+func fingerprintKey() string {
+	key := strings.Join([]string{runtime.GOOS, runtime.GOARCH, os.Getenv("PATH"), commandShell(), strings.Join(promptTools(), ",")}, "\n")
+	for _, path := range []string{"/etc/os-release", "/proc/sys/kernel/osrelease", "/System/Library/CoreServices/SystemVersion.plist"} {
+		if data, err := os.ReadFile(path); err == nil {
+			key += "\n" + string(data)
+		}
+	}
+	return fmt.Sprintf("%x", hashString(key))
+}
+
+// loadFingerprint returns the cached fingerprint, collecting a new one when
+// the environment changed or fingerprint.ttl has passed.
+func loadFingerprint() Fingerprint {
+	path := filepath.Join(storeDir, fingerprintFileName)
+	key := fingerprintKey()
+	var cached Fingerprint
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil {
+		if cached.Key == key && time.Since(cached.Collected) < viper.GetDuration("fingerprint.ttl") {
+			return cached
+		}
+	}
+
+	fingerprint := collectFingerprint()
+	fingerprint.Key = key
+	if data, err := json.MarshalIndent(fingerprint, "", "  "); err == nil {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			fmt.Printf("Failed to save environment fingerprint: %v\n", err)
+		}
+	}
+	return fingerprint
+}
+
+func collectFingerprint() Fingerprint {
+	f := Fingerprint{
+		Collected: time.Now(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Distro:    distro(),
+		Shell:     shellName(),
+		Tools:     availableTools(),
+	}
+	if runtime.GOOS != "windows" {
+		f.Kernel = commandOutput("uname", "-sr")
+		f.Coreutils = coreutilsFlavor()
+	}
+	f.ShellVersion = versionPattern.FindString(commandOutput(commandShell(), "--version"))
+	for _, manager := range packageManagers {
+		if _, err := exec.LookPath(manager); err == nil {
+			f.PackageManager = manager
+			break
+		}
+	}
+	return f
+}
+
+// coreutilsFlavor tells GNU coreutils from BusyBox and the BSD tools of
+// macOS, which reject --version.
+func coreutilsFlavor() string {
+	out := commandOutput("ls", "--version")
+	switch {
+	case strings.Contains(out, "GNU"):
+		return "GNU"
+	case strings.Contains(out, "BusyBox"):
+		return "BusyBox"
+	}
+	if _, err := exec.LookPath("gls"); err == nil {
+		return "BSD (GNU coreutils installed with a g prefix)"
+	}
+	return "BSD"
+}
+
+// commandOutput returns the first line of a command's output, or "" if it
+// fails or takes too long.
+func commandOutput(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line)
+}
+
+func distro() string {
+	switch runtime.GOOS {
+	case "linux":
+		f, err := os.Open("/etc/os-release")
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "PRETTY_NAME="); ok {
+				return strings.Trim(value, `"'`)
+			}
+		}
+	case "darwin":
+		if version := commandOutput("sw_vers", "-productVersion"); version != "" {
+			return "macOS " + version
+		}
+	}
+	return ""
+}
+
+// commandShell is the shell commands are run with, "sh" unless the
+// command_shell setting names another, such as zsh or fish.
+func commandShell() string {
+	if shell := viper.GetString("command_shell"); shell != "" {
+		return shell
+	}
+	return "sh"
+}
+
+// shellName is the shell the prompt reports: the one that runs commands,
+// not necessarily the user's login shell.
+func shellName() string {
+	return filepath.Base(commandShell())
+}
+
+func promptTools() []string {
+	if tools := viper.GetStringSlice("prompt.tools"); len(tools) > 0 {
+		return tools
+	}
+	return defaultPromptTools
+}
+
+func availableTools() []string {
+	var found []string
+	for _, tool := range promptTools() {
+		if _, err := exec.LookPath(tool); err == nil {
+			found = append(found, tool)
+		}
+	}
+	return found
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type GeminiPart struct {
+	Text string `json:"text"`
+}
+
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature     float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
+}
+
+type GeminiRequest struct {
+	SystemInstruction *GeminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []GeminiContent        `json:"contents"`
+	GenerationConfig  GeminiGenerationConfig `json:"generationConfig"`
+}
+
+type GeminiResponse struct {
+	Candidates []struct {
+		Content      GeminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+type GeminiEmbedRequest struct {
+	Model   string        `json:"model"`
+	Content GeminiContent `json:"content"`
+}
+
+type GeminiEmbedResponse struct {
+	Embedding struct {
+		Values []float32 `json:"values"`
+	} `json:"embedding"`
+}
+
+const geminiBaseURL = "https://generativelanguage.googleapis.com"
+
+type geminiProvider struct{}
+
+func init() {
+	registerProvider(geminiProvider{})
+}
+
+func (geminiProvider) Name() string { return "Gemini" }
+
+func (geminiProvider) Auth() AuthRequirements {
+	return AuthRequirements{APIKeyEnv: "GEMINI_API_KEY"}
+}
+
+func (geminiProvider) DefaultEmbeddingModel() string { return "text-embedding-004" }
+
+func (geminiProvider) ListModels() ([]string, error) {
+	return []string{"gemini-1.5-flash", "gemini-1.5-pro"}, nil
+}
+
+func (geminiProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:generateContent", geminiURL(), model)
+	return makeAPICall(ctx, apiURL, newGeminiRequest(messages), geminiHeaders(apiKey), processGeminiResponse)
+}
+
+func (geminiProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", geminiURL(), model)
+	return makeStreamingAPICall(ctx, apiURL, newGeminiRequest(messages), geminiHeaders(apiKey), processGeminiStreamEvent, onDelta)
+}
+
+func (geminiProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:embedContent", geminiURL(), model)
+	req := GeminiEmbedRequest{
+		Model:   "models/" + model,
+		Content: GeminiContent{Parts: []GeminiPart{{Text: input}}},
+	}
+	return makeAPICall(ctx, apiURL, req, geminiHeaders(apiKey), processGeminiEmbedResponse)
+}
+
+func geminiURL() string {
+	baseURL := strings.TrimRight(viper.GetString("gemini.base_url"), "/")
+	if baseURL == "" {
+		return geminiBaseURL
+	}
+	return baseURL
+}
+
+func geminiHeaders(apiKey string) map[string]string {
+	return map[string]string{
+		"Content-Type":   "application/json",
+		"x-goog-api-key": apiKey,
+	}
+}
+
+func newGeminiRequest(messages []AIMessage) GeminiRequest {
+	req := GeminiRequest{
+		GenerationConfig: GeminiGenerationConfig{
+			Temperature:     temperature,
+			MaxOutputTokens: maxTokens,
+		},
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			req.SystemInstruction = &GeminiContent{Parts: []GeminiPart{{Text: msg.Content}}}
+		case "assistant":
+			req.Contents = append(req.Contents, GeminiContent{Role: "model", Parts: []GeminiPart{{Text: msg.Content}}})
+		default:
+			req.Contents = append(req.Contents, GeminiContent{Role: "user", Parts: []GeminiPart{{Text: msg.Content}}})
+		}
+	}
+	return req
+}
+
+func geminiText(resp GeminiResponse) string {
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+func processGeminiResponse(body []byte, usage *Usage) (string, error) {
+	var apiResp GeminiResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	if apiResp.PromptFeedback.BlockReason != "" {
+		return "", fmt.Errorf("Gemini blocked the prompt: %s", apiResp.PromptFeedback.BlockReason)
+	}
+	text := geminiText(apiResp)
+	if text == "" {
+		return "", fmt.Errorf("The LLM returned an empty response")
+	}
+	usage.update(apiResp.UsageMetadata.PromptTokenCount, apiResp.UsageMetadata.CandidatesTokenCount)
+	return text, nil
+}
+
+func processGeminiStreamEvent(data []byte, usage *Usage) (string, error) {
+	var event GeminiResponse
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("Error unmarshaling stream event: %v", err)
+	}
+	if event.PromptFeedback.BlockReason != "" {
+		return "", fmt.Errorf("Gemini blocked the prompt: %s", event.PromptFeedback.BlockReason)
+	}
+	usage.update(event.UsageMetadata.PromptTokenCount, event.UsageMetadata.CandidatesTokenCount)
+	return geminiText(event), nil
+}
+
+func processGeminiEmbedResponse(body []byte, usage *Usage) ([]float32, error) {
+	var resp GeminiEmbedResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling embeddings response: %v", err)
+	}
+	if len(resp.Embedding.Values) == 0 {
+		return nil, fmt.Errorf("No embeddings returned")
+	}
+	return resp.Embedding.Values, nil
+}
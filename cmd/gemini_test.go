@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// newGeminiServer stands in for the Gemini API, checking the API key and
+// replying to generateContent, streamGenerateContent and embedContent.
+func newGeminiServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1beta/models/gemini-1.5-flash:generateContent", func(w http.ResponseWriter, r *http.Request) {
+		var req GeminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "Be brief." {
+			t.Errorf("system instruction = %+v, want %q", req.SystemInstruction, "Be brief.")
+		}
+		if len(req.Contents) != 1 || req.Contents[0].Role != "user" || req.Contents[0].Parts[0].Text != "list files" {
+			t.Errorf("contents = %+v, want one user message", req.Contents)
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"<command>ls</command>"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":4}}`)
+	})
+	mux.HandleFunc("/v1beta/models/gemini-1.5-flash:streamGenerateContent", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("alt = %q, want sse", r.URL.Query().Get("alt"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"<command>ls \"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"-la</command>\"}]}}],\"usageMetadata\":{\"promptTokenCount\":12,\"candidatesTokenCount\":6}}\n\n")
+	})
+	mux.HandleFunc("/v1beta/models/text-embedding-004:embedContent", func(w http.ResponseWriter, r *http.Request) {
+		var req GeminiEmbedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		if req.Model != "models/text-embedding-004" {
+			t.Errorf("model = %q, want models/text-embedding-004", req.Model)
+		}
+		fmt.Fprint(w, `{"embedding":{"values":[0.1,0.2,0.3]}}`)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+			t.Errorf("x-goog-api-key = %q, want test-key", got)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	viper.Set("gemini.base_url", server.URL)
+	t.Cleanup(func() { viper.Set("gemini.base_url", "") })
+	return server
+}
+
+var geminiTestMessages = []AIMessage{
+	{Role: "system", Content: "Be brief."},
+	{Role: "user", Content: "list files"},
+}
+
+func TestGeminiChat(t *testing.T) {
+	newGeminiServer(t)
+	ctx, usage := withUsage(context.Background())
+	text, err := geminiProvider{}.Chat(ctx, "gemini-1.5-flash", "test-key", geminiTestMessages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "<command>ls</command>" {
+		t.Errorf("text = %q", text)
+	}
+	if usage.PromptTokens != 12 || usage.CompletionTokens != 4 {
+		t.Errorf("usage = %+v, want 12 prompt and 4 completion tokens", *usage)
+	}
+}
+
+func TestGeminiChatStream(t *testing.T) {
+	newGeminiServer(t)
+	var deltas []string
+	text, err := geminiProvider{}.ChatStream(context.Background(), "gemini-1.5-flash", "test-key", geminiTestMessages, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "<command>ls -la</command>" {
+		t.Errorf("text = %q", text)
+	}
+	if len(deltas) != 2 {
+		t.Errorf("got %d deltas, want 2", len(deltas))
+	}
+}
+
+func TestGeminiEmbeddings(t *testing.T) {
+	newGeminiServer(t)
+	vector, err := geminiProvider{}.Embeddings(context.Background(), "text-embedding-004", "test-key", "list files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vector) != 3 || vector[1] != 0.2 {
+		t.Errorf("vector = %v", vector)
+	}
+}
+
+func TestGeminiBlockedPrompt(t *testing.T) {
+	var usage Usage
+	_, err := processGeminiResponse([]byte(`{"promptFeedback":{"blockReason":"SAFETY"}}`), &usage)
+	if err == nil {
+		t.Fatal("expected an error for a blocked prompt")
+	}
+}
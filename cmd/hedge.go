@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const maxLatencySamples = 200
+
+// HedgeStats is the record of one provider and model in hedged requests.
+// Latencies are of the replies that arrived before the race was decided.
+// Win rate and percentiles are kept up to date for reading the file.
+type HedgeStats struct {
+	Races     int     `json:"races"`
+	Wins      int     `json:"wins"`
+	WinRate   float64 `json:"win_rate"`
+	P50       int64   `json:"p50_ms"`
+	P90       int64   `json:"p90_ms"`
+	P99       int64   `json:"p99_ms"`
+	Latencies []int64 `json:"latencies_ms"`
+}
+
+type hedgeResult struct {
+	entry   ChainEntry
+	text    string
+	err     error
+	latency time.Duration
+}
+
+func hedgingEnabled() bool {
+	return viper.GetBool("hedge.enabled")
+}
+
+// hedgeProviders returns the providers to race: hedge.providers when set,
+// otherwise the provider and its fallbacks.
+func hedgeProviders() []ChainEntry {
+	var entries []ChainEntry
+	if err := viper.UnmarshalKey("hedge.providers", &entries); err != nil {
+		fmt.Printf("Ignoring invalid hedge configuration: %v\n", err)
+	}
+	if len(entries) == 0 {
+		return providerChain()
+	}
+	return entries
+}
+
+// callHedged sends the request to every hedged provider at once and returns
+// the first reply that contains a command, cancelling the others. If no
+// reply does, it returns the last one so the caller can ask for a reformat.
+func callHedged(ctx context.Context, messages []AIMessage, output *StructuredOutput) (string, ChainEntry, error) {
+	chain, err := budgetChain(hedgeProviders())
+	if err != nil {
+		return "", chain[0], err
+	}
+	breaker := loadCircuitBreaker()
+	defer breaker.save()
+
+	var keyed, entries []ChainEntry
+	for _, entry := range chain {
+		if getAPIKey(entry.Provider) != "" || !requiresAPIKey(entry.Provider) {
+			keyed = append(keyed, entry)
+		}
+	}
+	if len(keyed) == 0 {
+		return "", chain[0], ErrMissingAPIKey
+	}
+	for _, entry := range keyed {
+		if breaker.allow(entry.Provider) {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		entries = keyed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult, len(entries))
+	start := time.Now()
+	for _, entry := range entries {
+		go func(entry ChainEntry) {
+			text, err := callStreamingAPI(ctx, entry.Provider, entry.Model, getAPIKey(entry.Provider), messages, output, func(string) {})
+			results <- hedgeResult{entry: entry, text: text, err: err, latency: time.Since(start)}
+		}(entry)
+	}
+
+	stats := loadHedgeStats()
+	defer stats.save()
+	var unparsed, last hedgeResult
+	for range entries {
+		result := <-results
+		if result.err != nil {
+			if shouldFallback(result.err) {
+				breaker.recordFailure(result.entry.Provider)
+			}
+			last = result
+			continue
+		}
+		breaker.recordSuccess(result.entry.Provider)
+		stats.recordLatency(result)
+		if _, err := parseCommands(result.text); err != nil {
+			unparsed = result
+			continue
+		}
+		cancel()
+		stats.record(entries, result)
+		fmt.Printf("Fastest reply from %s in %.1fs.\n", result.entry.Provider, result.latency.Seconds())
+		return result.text, result.entry, nil
+	}
+	stats.record(entries, hedgeResult{})
+	if unparsed.text != "" {
+		return unparsed.text, unparsed.entry, nil
+	}
+	return "", last.entry, last.err
+}
+
+type hedgeStats struct {
+	path  string
+	stats map[string]*HedgeStats
+}
+
+func hedgeStatsKey(entry ChainEntry) string {
+	if entry.Model == "" {
+		return entry.Provider
+	}
+	return entry.Provider + " " + entry.Model
+}
+
+func loadHedgeStats() *hedgeStats {
+	s := &hedgeStats{
+		path:  filepath.Join(storeDir, hedgeStatsFileName),
+		stats: map[string]*HedgeStats{},
+	}
+	if data, err := os.ReadFile(s.path); err == nil {
+		json.Unmarshal(data, &s.stats)
+	}
+	return s
+}
+
+func (s *hedgeStats) entry(entry ChainEntry) *HedgeStats {
+	key := hedgeStatsKey(entry)
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &HedgeStats{}
+		s.stats[key] = stat
+	}
+	return stat
+}
+
+// recordLatency adds a sample for a reply that arrived, whether or not it
+// won. Requests cancelled after another provider won have no sample.
+func (s *hedgeStats) recordLatency(result hedgeResult) {
+	stat := s.entry(result.entry)
+	stat.Latencies = append(stat.Latencies, result.latency.Milliseconds())
+	if len(stat.Latencies) > maxLatencySamples {
+		stat.Latencies = stat.Latencies[len(stat.Latencies)-maxLatencySamples:]
+	}
+}
+
+// record counts a race for every entry and a win for the winner, if there
+// was one.
+func (s *hedgeStats) record(entries []ChainEntry, winner hedgeResult) {
+	for _, entry := range entries {
+		stat := s.entry(entry)
+		stat.Races++
+		if winner.entry.Provider != "" && entry == winner.entry {
+			stat.Wins++
+		}
+		stat.WinRate = float64(stat.Wins) / float64(stat.Races)
+		stat.P50 = percentile(stat.Latencies, 0.50)
+		stat.P90 = percentile(stat.Latencies, 0.90)
+		stat.P99 = percentile(stat.Latencies, 0.99)
+	}
+}
+
+func (s *hedgeStats) save() {
+	data, err := json.MarshalIndent(s.stats, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		fmt.Printf("Failed to save hedge stats: %v\n", err)
+	}
+}
+
+func percentile(samples []int64, p float64) int64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func showHedgeStats() {
+	stats := loadHedgeStats().stats
+	if len(stats) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HEDGED\tRACES\tWINS\tWIN RATE\tP50\tP90\tP99")
+	for _, key := range keys {
+		s := stats[key]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f%%\t%dms\t%dms\t%dms\n", key, s.Races, s.Wins, s.WinRate*100, s.P50, s.P90, s.P99)
+	}
+	w.Flush()
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var hedgeTestMessages = []AIMessage{
+	{Role: "system", Content: "Translate the request."},
+	{Role: "user", Content: "list files"},
+}
+
+func TestHedgeRacesOpenCircuits(t *testing.T) {
+	useTempStore(t)
+	viper.Set("hedge.providers", []map[string]interface{}{{"provider": "Local Rules"}})
+	viper.Set("circuit_breaker.cooldown", time.Hour)
+	breaker := loadCircuitBreaker()
+	breaker.recordFailure("Local Rules")
+	breaker.save()
+
+	_, entry, err := callHedged(context.Background(), hedgeTestMessages, nil)
+	if err != nil {
+		t.Fatalf("callHedged with every circuit open: %v", err)
+	}
+	if entry.Provider != "Local Rules" {
+		t.Errorf("answered by %q, want Local Rules", entry.Provider)
+	}
+}
+
+func TestHedgeMissingAPIKey(t *testing.T) {
+	useTempStore(t)
+	t.Setenv("OPENAI_API_KEY", "")
+	viper.Set("hedge.providers", []map[string]interface{}{{"provider": "OpenAI", "model": "gpt-4o"}})
+
+	if _, _, err := callHedged(context.Background(), hedgeTestMessages, nil); !errors.Is(err, ErrMissingAPIKey) {
+		t.Errorf("callHedged without a key: %v, want ErrMissingAPIKey", err)
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPSettings configures the proxy and TLS for provider calls. The global
+// settings live under "http"; entries in "http.providers" override them
+// field by field for one provider.
+type HTTPSettings struct {
+	Provider           string `mapstructure:"provider"`
+	Proxy              string `mapstructure:"proxy"`
+	NoProxy            string `mapstructure:"no_proxy"`
+	CABundle           string `mapstructure:"ca_bundle"`
+	ClientCert         string `mapstructure:"client_cert"`
+	ClientKey          string `mapstructure:"client_key"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = map[string]*http.Client{}
+)
+
+type providerKey struct{}
+
+// withProvider records which provider a call is for, so the HTTP client can
+// apply that provider's proxy and TLS settings.
+func withProvider(ctx context.Context, provider string) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+func providerFromContext(ctx context.Context) string {
+	provider, _ := ctx.Value(providerKey{}).(string)
+	return provider
+}
+
+// newHTTPClient returns the client for provider, built once per run and
+// shared by chat, embeddings and model listing.
+func newHTTPClient(provider string) (*http.Client, error) {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	if client, ok := httpClients[provider]; ok {
+		return client, nil
+	}
+
+	settings, err := httpSettings(provider)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := proxyFunc(settings)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	connectTimeout := viper.GetDuration("timeouts.connect")
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: viper.GetDuration("timeouts.response_header"),
+	}
+	cassette, err := loadCassette()
+	if err != nil {
+		return nil, err
+	}
+	if cassette != nil {
+		transport = cassette.transport(transport)
+	}
+	if debugLog != nil {
+		transport = &loggingTransport{next: transport}
+	}
+	client := &http.Client{Transport: transport}
+	httpClients[provider] = client
+	return client, nil
+}
+
+func httpSettings(provider string) (HTTPSettings, error) {
+	var settings HTTPSettings
+	if err := viper.UnmarshalKey("http", &settings); err != nil {
+		return settings, fmt.Errorf("Invalid http configuration: %v", err)
+	}
+	var overrides []HTTPSettings
+	if err := viper.UnmarshalKey("http.providers", &overrides); err != nil {
+		return settings, fmt.Errorf("Invalid http.providers configuration: %v", err)
+	}
+	for _, override := range overrides {
+		if provider == "" || !strings.EqualFold(override.Provider, provider) {
+			continue
+		}
+		if override.Proxy != "" {
+			settings.Proxy = override.Proxy
+		}
+		if override.NoProxy != "" {
+			settings.NoProxy = override.NoProxy
+		}
+		if override.CABundle != "" {
+			settings.CABundle = override.CABundle
+		}
+		if override.ClientCert != "" {
+			settings.ClientCert = override.ClientCert
+			settings.ClientKey = override.ClientKey
+		}
+		if override.InsecureSkipVerify {
+			settings.InsecureSkipVerify = true
+		}
+	}
+	return settings, nil
+}
+
+// proxyFunc uses the standard proxy environment variables unless a proxy
+// is configured, which then takes precedence. "direct" disables proxying.
+func proxyFunc(settings HTTPSettings) (func(*http.Request) (*url.URL, error), error) {
+	switch strings.ToLower(settings.Proxy) {
+	case "direct", "none":
+		return nil, nil
+	case "":
+		if settings.NoProxy == "" {
+			return http.ProxyFromEnvironment, nil
+		}
+	}
+
+	config := httpproxy.FromEnvironment()
+	if settings.Proxy != "" {
+		if _, err := url.Parse(settings.Proxy); err != nil {
+			return nil, fmt.Errorf("Invalid proxy URL %s: %v", settings.Proxy, err)
+		}
+		config.HTTPProxy = settings.Proxy
+		config.HTTPSProxy = settings.Proxy
+	}
+	if settings.NoProxy != "" {
+		config.NoProxy = settings.NoProxy
+	}
+	proxy := config.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}, nil
+}
+
+// newTLSConfig adds the CA bundle to the system roots and loads the client
+// certificate for mTLS. The key may be in the certificate file.
+func newTLSConfig(settings HTTPSettings) (*tls.Config, error) {
+	if settings.CABundle == "" && settings.ClientCert == "" && !settings.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+
+	if settings.CABundle != "" {
+		path := expandHome(settings.CABundle)
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", path)
+		}
+		config.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" {
+		keyFile := settings.ClientKey
+		if keyFile == "" {
+			keyFile = settings.ClientCert
+		}
+		cert, err := tls.LoadX509KeyPair(expandHome(settings.ClientCert), expandHome(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
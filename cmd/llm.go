@@ -2,19 +2,25 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Command struct {
-	XMLName xml.Name `xml:"command"`
-	Content string   `xml:",chardata"`
+	XMLName      xml.Name `xml:"command" json:"-"`
+	Content      string   `xml:",chardata" json:"command"`
+	Explanation  string   `xml:"-" json:"explanation"`
+	RiskLevel    string   `xml:"-" json:"risk_level"`
+	RequiresSudo bool     `xml:"-" json:"requires_sudo"`
+	Assumptions  []string `xml:"-" json:"assumptions"`
 }
 
 type AIMessage struct {
@@ -22,183 +28,42 @@ type AIMessage struct {
 	Content string `json:"content"`
 }
 
-type OpenAIRequest struct {
-	Model       string      `json:"model"`
-	Messages    []AIMessage `json:"messages"`
-	MaxTokens   int         `json:"max_tokens"`
-	Temperature float64     `json:"temperature,omitempty"`
-}
-
-type OpenAIResponse struct {
-	Choices []struct {
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-	} `json:"choices"`
-}
-
-type AnthropicRequest struct {
-	System      string      `json:"system"`
-	Messages    []AIMessage `json:"messages"`
-	Model       string      `json:"model"`
-	MaxTokens   int         `json:"max_tokens"`
-	Temperature float64     `json:"temperature,omitempty"`
-}
-
-type AnthropicResponse struct {
-	Content []struct {
-		Text string `json:"text"`
-	} `json:"content"`
-}
-
-type CloudflareRequest struct {
-	Messages    []AIMessage `json:"messages"`
-	MaxTokens   int         `json:"max_tokens"`
-	Temperature float64     `json:"temperature,omitempty"`
-}
-
-type CloudflareResponse struct {
-	Result struct {
-		Response string `json:"response"`
-	} `json:"result"`
-}
-
-type OpenAIEmbeddingRequest struct {
-	Model string      `json:"model"`
-	Input interface{} `json:"input"`
-}
-
-type OpenAIEmbeddingResponse struct {
-	Object string `json:"object"`
-	Data   []struct {
-		Object    string    `json:"object"`
-		Index     int       `json:"index"`
-		Embedding []float32 `json:"embedding"`
-	} `json:"data"`
-	Model string `json:"model"`
-	Usage struct {
-		PromptTokens int `json:"prompt_tokens"`
-		TotalTokens  int `json:"total_tokens"`
-	} `json:"usage"`
-}
-
-func callAPI[T any](provider, model, apiKey string, input interface{}, requestType RequestType) (T, error) {
-	var (
-		apiURL          string
-		req             interface{}
-		headers         = map[string]string{"Content-Type": "application/json"}
-		processResponse func([]byte) (T, error)
-	)
-
-	switch provider {
-	case "Anthropic":
-		apiURL = "https://api.anthropic.com/v1/messages"
-		headers["x-api-key"] = apiKey
-		headers["anthropic-version"] = "2023-06-01"
+func callAPI[T any](ctx context.Context, provider, model, apiKey string, input interface{}, requestType RequestType) (T, error) {
+	var zero T
+	p, err := getProvider(provider)
+	if err != nil {
+		return zero, err
+	}
 
+	ctx = withProvider(ctx, provider)
+	ctx, usage := withUsage(ctx)
+	var result interface{}
+	switch requestType {
+	case LLMRequest:
 		messages, ok := input.([]AIMessage)
 		if !ok {
-			var zero T
-			return zero, fmt.Errorf("Invalid input type for Anthropic")
-		}
-		filteredMessages := filterSystemMessages(messages)
-
-		req = AnthropicRequest{
-			System:      systemPrompt,
-			Messages:    filteredMessages,
-			Model:       model,
-			MaxTokens:   maxTokens,
-			Temperature: temperature,
-		}
-
-		processResponse = func(body []byte) (T, error) {
-			var apiResp AnthropicResponse
-			if err := json.Unmarshal(body, &apiResp); err != nil {
-				var zero T
-				return zero, fmt.Errorf("Error unmarshaling JSON: %v", err)
-			}
-			if len(apiResp.Content) == 0 || apiResp.Content[0].Text == "" {
-				var zero T
-				return zero, fmt.Errorf("The LLM returned an empty response")
-			}
-			return any(apiResp.Content[0].Text).(T), nil
-		}
-
-	case "OpenAI", "Ollama":
-		baseURL := map[string]string{
-			"OpenAI": "https://api.openai.com",
-			"Ollama": "http://localhost:11434",
-		}[provider]
-		if provider == "OpenAI" {
-			headers["Authorization"] = "Bearer " + apiKey
-		}
-		switch requestType {
-		case LLMRequest:
-			apiURL = baseURL + "/v1/chat/completions"
-			messages, ok := input.([]AIMessage)
-			if !ok {
-				var zero T
-				return zero, fmt.Errorf("Invalid input type for LLM request")
-			}
-			req = OpenAIRequest{
-				Model:       model,
-				Messages:    messages,
-				MaxTokens:   maxTokens,
-				Temperature: temperature,
-			}
-			processResponse = processLLMResponse[T]
-		case EmbeddingsRequest:
-			apiURL = baseURL + "/v1/embeddings"
-			req = OpenAIEmbeddingRequest{
-				Input: input.(string),
-				Model: model,
-			}
-			processResponse = processEmbeddingResponse[T]
-		default:
-			var zero T
-			return zero, fmt.Errorf("Invalid request type for %s provider", provider)
-		}
-	case "Cloudflare":
-		accountID := viper.GetString("cloudflare_account_id")
-		if accountID == "" {
-			accountID = os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+			return zero, fmt.Errorf("Invalid input type for LLM request")
 		}
-		if accountID == "" {
-			var zero T
-			return zero, fmt.Errorf("Cloudflare Account ID not set. Use 'ai config' or set the CLOUDFLARE_ACCOUNT_ID environment variable")
-		}
-		apiURL = fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/run/%s", accountID, model)
-		headers["Authorization"] = "Bearer " + apiKey
-		messages, ok := input.([]AIMessage)
+		result, err = p.Chat(ctx, model, apiKey, messages)
+	case EmbeddingsRequest:
+		text, ok := input.(string)
 		if !ok {
-			var zero T
-			return zero, fmt.Errorf("Invalid input type for Cloudflare")
-		}
-		req = CloudflareRequest{
-			Messages:    messages,
-			MaxTokens:   maxTokens,
-			Temperature: temperature,
+			return zero, fmt.Errorf("Invalid input type for embeddings request")
 		}
-		processResponse = func(body []byte) (T, error) {
-			var apiResp CloudflareResponse
-			if err := json.Unmarshal(body, &apiResp); err != nil {
-				var zero T
-				return zero, fmt.Errorf("Error unmarshaling JSON: %v", err)
-			}
-			if apiResp.Result.Response == "" {
-				var zero T
-				return zero, fmt.Errorf("No result in the API response")
-			}
-			return any(apiResp.Result.Response).(T), nil
-		}
-
+		result, err = p.Embeddings(ctx, model, apiKey, text)
 	default:
-		var zero T
-		return zero, fmt.Errorf("Unsupported provider: %s", provider)
+		return zero, fmt.Errorf("Invalid request type for %s provider", provider)
 	}
+	if err != nil {
+		return zero, err
+	}
+	recordUsage(provider, model, requestType, *usage)
 
-	return makeAPICall(apiURL, req, headers, processResponse)
+	value, ok := result.(T)
+	if !ok {
+		return zero, fmt.Errorf("Unexpected response type %T from %s provider", result, provider)
+	}
+	return value, nil
 }
 
 func filterSystemMessages(messages []AIMessage) []AIMessage {
@@ -211,56 +76,168 @@ func filterSystemMessages(messages []AIMessage) []AIMessage {
 	return filtered
 }
 
-func processLLMResponse[T any](body []byte) (T, error) {
-	var apiResp OpenAIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		var zero T
-		return zero, fmt.Errorf("Error unmarshaling JSON: %v", err)
-	}
-	if len(apiResp.Choices) == 0 {
-		var zero T
-		return zero, fmt.Errorf("No choices in the API response")
+func systemMessage(messages []AIMessage) string {
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			return msg.Content
+		}
 	}
-	content := apiResp.Choices[0].Message.Content
-	return any(content).(T), nil
+	return ""
 }
 
-func processEmbeddingResponse[T any](body []byte) (T, error) {
-	var resp OpenAIEmbeddingResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		var zero T
-		return zero, fmt.Errorf("Error unmarshaling embeddings response: %v", err)
+// callStreamingAPI asks for output as structured JSON when the provider
+// supports it, and otherwise for free text. Either is streamed to onDelta
+// when the provider can stream it.
+func callStreamingAPI(ctx context.Context, provider, model, apiKey string, messages []AIMessage, output *StructuredOutput, onDelta func(string)) (string, error) {
+	p, err := getProvider(provider)
+	if err != nil {
+		return "", err
 	}
-	if len(resp.Data) == 0 {
-		var zero T
-		return zero, fmt.Errorf("No embeddings returned")
+	messages, err = commandPromptMessages(ctx, provider, messages)
+	if err != nil {
+		return "", err
+	}
+	ctx = withProvider(ctx, provider)
+	ctx, usage := withUsage(ctx)
+	var text string
+	structured := output != nil && viper.GetBool("structured_output")
+	if sp, ok := p.(StructuredStreamingProvider); ok && structured && viper.GetBool("stream") {
+		text, err = sp.ChatStructuredStream(ctx, model, apiKey, messages, *output, onDelta)
+	} else if sp, ok := p.(StructuredProvider); ok && structured {
+		text, err = sp.ChatStructured(ctx, model, apiKey, messages, *output)
+	} else if sp, ok := p.(StreamingProvider); ok && viper.GetBool("stream") {
+		text, err = sp.ChatStream(ctx, model, apiKey, messages, onDelta)
+	} else {
+		text, err = p.Chat(ctx, model, apiKey, messages)
+		if err == nil {
+			onDelta(text)
+		}
+	}
+	if err == nil {
+		recordUsage(provider, model, LLMRequest, *usage)
 	}
-	embedding := resp.Data[0].Embedding
-	return any(embedding).(T), nil
+	return text, err
 }
 
-func makeAPICall[T any](apiURL string, req interface{}, headers map[string]string, processResponse func([]byte) (T, error)) (T, error) {
+func sendAPIRequest(ctx context.Context, apiURL string, req interface{}, headers map[string]string) (*http.Response, error) {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
-		var zero T
-		return zero, fmt.Errorf("Error marshaling JSON: %v", err)
+		return nil, fmt.Errorf("Error marshaling JSON: %v", err)
 	}
 
-	client := &http.Client{}
-	request, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqBody))
+	client, err := newHTTPClient(providerFromContext(ctx))
 	if err != nil {
-		var zero T
-		return zero, fmt.Errorf("Error creating request: %v", err)
+		return nil, fmt.Errorf("Error configuring HTTP client: %v", err)
+	}
+	maxAttempts := viper.GetInt("retry.max_attempts")
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := doAPIRequest(ctx, client, apiURL, reqBody, headers)
+		if err == nil {
+			return resp, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.retryable() || attempt >= maxAttempts {
+			return nil, err
+		}
+		delay := retryDelay(attempt, apiErr.RetryAfter)
+		if maxDelay := viper.GetDuration("retry.max_delay"); maxDelay > 0 && delay > maxDelay {
+			return nil, err
+		}
+		fmt.Printf("Request failed (%v), retrying in %s...\n", apiErr.Kind, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func doAPIRequest(ctx context.Context, client *http.Client, apiURL string, reqBody []byte, headers map[string]string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request: %v", err)
+	}
+
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if errors.Is(err, ErrCassetteMiss) {
+			return nil, err
+		}
+		return nil, &APIError{Kind: ErrNetwork, Err: err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, &APIError{Kind: ErrNetwork, Err: fmt.Errorf("Error reading response: %v", err)}
+		}
+		return nil, newStatusError(resp, body)
+	}
+	return resp, nil
+}
+
+// withRequestTimeout bounds a whole provider call, including reading a
+// streamed response body.
+func withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout := viper.GetDuration("timeouts.request"); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
 	}
+	return context.WithCancel(ctx)
+}
 
+func getJSON(ctx context.Context, apiURL string, headers map[string]string, out interface{}) error {
+	shared, err := newHTTPClient(providerFromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Error configuring HTTP client: %v", err)
+	}
+	client := *shared
+	client.Timeout = 5 * time.Second
+	request, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("Error creating request: %v", err)
+	}
 	for key, value := range headers {
 		request.Header.Set(key, value)
 	}
 
 	resp, err := client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &APIError{Kind: ErrNetwork, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newStatusError(resp, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	return nil
+}
+
+func makeAPICall[T any](ctx context.Context, apiURL string, req interface{}, headers map[string]string, processResponse func([]byte, *Usage) (T, error)) (T, error) {
+	ctx, cancel := withRequestTimeout(ctx)
+	defer cancel()
+	resp, err := sendAPIRequest(ctx, apiURL, req, headers)
 	if err != nil {
 		var zero T
-		return zero, fmt.Errorf("Error sending request: %v", err)
+		return zero, err
 	}
 	defer resp.Body.Close()
 
@@ -270,10 +247,10 @@ func makeAPICall[T any](apiURL string, req interface{}, headers map[string]strin
 		return zero, fmt.Errorf("Error reading response: %v", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		var zero T
-		return zero, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, body)
+	var usage Usage
+	result, err := processResponse(body, &usage)
+	if err == nil {
+		reportUsage(ctx, usage)
 	}
-
-	return processResponse(body)
+	return result, err
 }
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	localEmbedderName  = "Local Embeddings"
+	localEmbedderModel = "hashed-ngrams"
+)
+
+// Words that say little about which command is wanted, weighted down in
+// place of document frequencies, which a single query does not have.
+var localStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "to": true, "of": true, "in": true,
+	"on": true, "for": true, "and": true, "or": true, "with": true, "from": true,
+	"is": true, "are": true, "it": true, "this": true, "that": true, "my": true,
+	"me": true, "i": true, "please": true, "can": true, "you": true, "how": true,
+}
+
+// localEmbedderProvider embeds text without any API, so the semantic cache
+// works offline and with chat-only providers.
+type localEmbedderProvider struct{}
+
+func init() {
+	registerProvider(localEmbedderProvider{})
+}
+
+func (localEmbedderProvider) Name() string { return localEmbedderName }
+
+func (localEmbedderProvider) Auth() AuthRequirements { return AuthRequirements{} }
+
+func (localEmbedderProvider) DefaultEmbeddingModel() string { return localEmbedderModel }
+
+func (localEmbedderProvider) SupportsChat() bool { return false }
+
+func (localEmbedderProvider) SupportsEmbeddings() bool { return true }
+
+func (localEmbedderProvider) ListModels() ([]string, error) {
+	return []string{localEmbedderModel}, nil
+}
+
+func (localEmbedderProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	return "", fmt.Errorf("%s only provides embeddings", localEmbedderName)
+}
+
+func (localEmbedderProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	return localEmbed(input, vectorSize), nil
+}
+
+func localEmbedding(value string) Embedding {
+	return Embedding{
+		Vector:   localEmbed(value, vectorSize),
+		Embedder: embedderTag(localEmbedderName, localEmbedderModel, vectorSize),
+	}
+}
+
+// localEmbed projects word unigrams, word bigrams and character trigrams into
+// dims dimensions with signed feature hashing. Term counts are log-scaled and
+// the result is L2-normalized, so cosine distance compares phrasings.
+func localEmbed(text string, dims int) []float32 {
+	vector := make([]float32, dims)
+	if dims == 0 {
+		return vector
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !strings.ContainsRune("-_./~", r)
+	})
+
+	counts := map[string]float64{}
+	for i, word := range words {
+		weight := 1.0
+		if localStopWords[word] {
+			weight = 0.2
+		}
+		counts["w:"+word] += weight
+		if i > 0 {
+			counts["b:"+words[i-1]+" "+word] += 0.5 * weight
+		}
+		padded := []rune(" " + word + " ")
+		for j := 0; j+3 <= len(padded); j++ {
+			counts["c:"+string(padded[j:j+3])] += 0.25 * weight
+		}
+	}
+
+	for feature, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		weight := float32(math.Log1p(count))
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(dims)] += weight
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
+
+// embeddingFallback switches to the local embedder when the remote one is
+// unavailable. With local_embeddings.fallback off, configuration errors exit
+// and transient failures skip the cache.
+func embeddingFallback(value, reason string, fatal bool) Embedding {
+	if viper.GetBool("local_embeddings.fallback") {
+		fmt.Printf("%s Using local embeddings.\n", reason)
+		return localEmbedding(value)
+	}
+	if fatal {
+		fmt.Println(reason)
+		exit(1)
+	}
+	fmt.Printf("%s Skipping the semantic cache.\n", reason)
+	return Embedding{}
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// LocalRule maps requests matching Pattern to Command, a text/template that
+// can use the pattern's named groups. Rules with an OS only apply there.
+type LocalRule struct {
+	Pattern     string `mapstructure:"pattern"`
+	Command     string `mapstructure:"command"`
+	Explanation string `mapstructure:"explanation"`
+	OS          string `mapstructure:"os"`
+}
+
+const defaultLocalRules = `# Rules for the Local Rules provider, tried in order. Each pattern is a Go
+# regular expression matched against the request; the command is a Go
+# template that can use the named groups. Always pass user text through
+# quote, which escapes it for the shell.
+rules:
+  - pattern: '(?i)^(?:list|show)(?: all)? files(?: in (?P<dir>.+))?$'
+    command: 'ls -la {{with .dir}}{{quote .}}{{else}}.{{end}}'
+    explanation: List files with details
+  - pattern: '(?i)^find (?:files? )?named (?P<name>.+)$'
+    command: 'find . -name {{quote .name}}'
+    explanation: Search the current directory tree by name
+  - pattern: '(?i)disk (?:usage|space)'
+    command: 'df -h'
+    explanation: Show free space on mounted filesystems
+  - pattern: '(?i)^(?:where am i|(?:print|show) (?:the )?(?:current|working) directory)$'
+    command: 'pwd'
+    explanation: Print the working directory
+`
+
+const localRulesName = "Local Rules"
+
+type localRulesProvider struct{}
+
+func init() {
+	registerProvider(localRulesProvider{})
+}
+
+func (localRulesProvider) Name() string { return localRulesName }
+
+func (localRulesProvider) Auth() AuthRequirements { return AuthRequirements{} }
+
+func (localRulesProvider) DefaultEmbeddingModel() string { return "" }
+
+func (localRulesProvider) SupportsChat() bool { return true }
+
+func (localRulesProvider) SupportsEmbeddings() bool { return false }
+
+func (localRulesProvider) ListModels() ([]string, error) {
+	return []string{"default"}, nil
+}
+
+// Chat answers from the rules file without any network access. Commands
+// that were already tried in the conversation are skipped, so a retry gets
+// the next matching rule.
+func (localRulesProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	path := localRulesPath()
+	rules, err := loadLocalRules(path)
+	if err != nil {
+		return "", err
+	}
+
+	request := localRulesRequest(messages)
+	tried := map[string]bool{}
+	for _, msg := range messages {
+		if msg.Role == "assistant" {
+			tried[strings.TrimSpace(msg.Content)] = true
+		}
+	}
+
+	limit := max(1, viper.GetInt("candidates"))
+	var reply strings.Builder
+	found := 0
+	for i, rule := range rules {
+		if found == limit {
+			break
+		}
+		if rule.OS != "" && !strings.EqualFold(rule.OS, runtime.GOOS) {
+			continue
+		}
+		command, ok, err := rule.apply(request)
+		if err != nil {
+			return "", fmt.Errorf("Rule %d in %s: %v", i+1, path, err)
+		}
+		if !ok || tried[command] {
+			continue
+		}
+		fmt.Fprintf(&reply, "%s%s%s\n%s\n", commandOpenTag, command, commandCloseTag, rule.Explanation)
+		found++
+	}
+	if found == 0 {
+		return "", fmt.Errorf("No local rule matches %q. Add one to %s", request, path)
+	}
+	return reply.String(), nil
+}
+
+func (localRulesProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	return nil, fmt.Errorf("Embeddings are not supported for Local Rules")
+}
+
+func localRulesPath() string {
+	if path := viper.GetString("local_rules.file"); path != "" {
+		return expandHome(path)
+	}
+	return filepath.Join(storeDir, localRulesFileName)
+}
+
+// loadLocalRules reads the rules file, creating it with example rules the
+// first time.
+func loadLocalRules(path string) ([]LocalRule, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(path, []byte(defaultLocalRules), 0644); err != nil {
+			return nil, fmt.Errorf("Error creating rules file: %v", err)
+		}
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Error reading rules file: %v", err)
+	}
+	var rules []LocalRule
+	if err := v.UnmarshalKey("rules", &rules); err != nil {
+		return nil, fmt.Errorf("Invalid rules in %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// localRulesRequest returns the user's original request: the first user
+// message, without instructions appended after a blank line.
+func localRulesRequest(messages []AIMessage) string {
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			request, _, _ := strings.Cut(msg.Content, "\n\n")
+			return strings.TrimSpace(request)
+		}
+	}
+	return ""
+}
+
+func (r LocalRule) apply(request string) (string, bool, error) {
+	pattern, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid pattern: %v", err)
+	}
+	match := pattern.FindStringSubmatch(request)
+	if match == nil {
+		return "", false, nil
+	}
+	groups := map[string]string{}
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+
+	tmpl, err := template.New("command").Funcs(template.FuncMap{"quote": shellQuote}).Parse(r.Command)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid command template: %v", err)
+	}
+	var command strings.Builder
+	if err := tmpl.Execute(&command, groups); err != nil {
+		return "", false, fmt.Errorf("invalid command template: %v", err)
+	}
+	return strings.TrimSpace(command.String()), true, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
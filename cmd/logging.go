@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// debugLog is set by --verbose or --debug. Verbose logs one line per
+// provider request; debug adds headers, payloads and response bodies.
+var (
+	debugLog     *slog.Logger
+	debugLogFile *rotatingFile
+)
+
+func initLogging() {
+	level := slog.LevelInfo
+	switch {
+	case viper.GetBool("debug"):
+		level = slog.LevelDebug
+	case viper.GetBool("verbose"):
+	default:
+		return
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	if strings.EqualFold(viper.GetString("log.output"), "file") {
+		file := &rotatingFile{
+			path:    filepath.Join(storeDir, logFileName),
+			maxSize: int64(viper.GetInt("log.max_size")) << 20,
+			backups: viper.GetInt("log.max_backups"),
+		}
+		err := file.open()
+		if err == nil {
+			debugLogFile = file
+			debugLog = slog.New(slog.NewJSONHandler(file, options))
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Error opening log file: %v. Logging to stderr.\n", err)
+	}
+	debugLog = slog.New(slog.NewTextHandler(os.Stderr, options))
+}
+
+func closeLogging() {
+	if debugLogFile != nil {
+		debugLogFile.Close()
+		debugLogFile = nil
+	}
+}
+
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	debug := debugLog.Enabled(ctx, slog.LevelDebug)
+	attrs := []any{"provider", providerFromContext(ctx), "method", req.Method, "url", maskURL(req.URL)}
+
+	if debug {
+		var body []byte
+		if req.Body != nil {
+			var err error
+			body, err = io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		debugLog.DebugContext(ctx, "request", append(attrs, "headers", maskHeaders(req.Header), "body", string(body))...)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		debugLog.WarnContext(ctx, "request failed", append(attrs, "latency", latency, "error", err)...)
+		return nil, err
+	}
+	attrs = append(attrs, "status", resp.StatusCode, "latency", latency)
+	if !debug {
+		debugLog.InfoContext(ctx, "response", attrs...)
+		return resp, nil
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(data []byte) {
+			debugLog.DebugContext(ctx, "response", append(attrs,
+				"duration", time.Since(start),
+				"headers", maskHeaders(resp.Header),
+				"body", string(data))...)
+		},
+	}
+	return resp, nil
+}
+
+// maskHeaders masks credentials with maskAPIKey, keeping an auth scheme
+// such as "Bearer" readable.
+func maskHeaders(headers http.Header) http.Header {
+	masked := http.Header{}
+	for name, values := range headers {
+		if !isSecretName(name) {
+			masked[name] = values
+			continue
+		}
+		for _, value := range values {
+			scheme, token, found := strings.Cut(value, " ")
+			if found {
+				value = scheme + " " + maskAPIKey(token)
+			} else {
+				value = maskAPIKey(value)
+			}
+			masked[name] = append(masked[name], value)
+		}
+	}
+	return masked
+}
+
+func maskURL(u *url.URL) string {
+	masked := *u
+	masked.User = nil
+	query := masked.Query()
+	for name, values := range query {
+		if isSecretName(name) {
+			for i, value := range values {
+				values[i] = maskAPIKey(value)
+			}
+		}
+	}
+	masked.RawQuery = query.Encode()
+	return masked.String()
+}
+
+// rotatingFile appends to a log file, renaming it to path.1, path.2, ...
+// once it grows past maxSize and keeping at most backups old files.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	for i := f.backups; i > 0; i-- {
+		older := fmt.Sprintf("%s.%d", f.path, i-1)
+		if i == 1 {
+			older = f.path
+		}
+		os.Rename(older, fmt.Sprintf("%s.%d", f.path, i))
+	}
+	if f.backups == 0 {
+		os.Remove(f.path)
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type cachedModelList struct {
+	Fetched time.Time `json:"fetched"`
+	Models  []string  `json:"models"`
+}
+
+// discoverModels returns the models a provider offers, from the cache when
+// it is younger than models.cache_ttl. Without credentials, or when the
+// provider cannot be reached, it falls back to the built-in list.
+func discoverModels(provider string, builtIn []string, fetch func(context.Context) ([]string, error)) []string {
+	path := filepath.Join(storeDir, modelsCacheFileName)
+	cache := map[string]cachedModelList{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	if cached, ok := cache[provider]; ok && time.Since(cached.Fetched) < viper.GetDuration("models.cache_ttl") {
+		return cached.Models
+	}
+	if getAPIKey(provider) == "" && requiresAPIKey(provider) {
+		return builtIn
+	}
+
+	models, err := fetch(withProvider(context.Background(), provider))
+	if err != nil || len(models) == 0 {
+		return builtIn
+	}
+	sort.Strings(models)
+	cache[provider] = cachedModelList{Fetched: time.Now(), Models: models}
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		os.WriteFile(path, data, 0644)
+	}
+	return models
+}
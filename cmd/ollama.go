@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+type OllamaModel struct {
+	Name string `json:"name"`
+}
+
+type OllamaResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+type OllamaOptions struct {
+	Temperature float64 `json:"temperature,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+	NumCtx      int     `json:"num_ctx,omitempty"`
+}
+
+type OllamaChatRequest struct {
+	Model     string        `json:"model"`
+	Messages  []AIMessage   `json:"messages"`
+	Stream    bool          `json:"stream"`
+	Format    interface{}   `json:"format,omitempty"`
+	KeepAlive string        `json:"keep_alive,omitempty"`
+	Options   OllamaOptions `json:"options"`
+}
+
+type OllamaChatResponse struct {
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	Error           string `json:"error"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+type OllamaEmbedRequest struct {
+	Model     string        `json:"model"`
+	Input     string        `json:"input"`
+	KeepAlive string        `json:"keep_alive,omitempty"`
+	Options   OllamaOptions `json:"options"`
+}
+
+type OllamaEmbedResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+type OllamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+const ollamaBaseURL = "http://localhost:11434"
+
+// ollamaInstalledModels is a sync.Map since hedged requests can check
+// several models at once.
+var ollamaInstalledModels sync.Map
+
+type ollamaProvider struct{}
+
+func init() {
+	registerProvider(ollamaProvider{})
+}
+
+func (ollamaProvider) Name() string { return "Ollama" }
+
+func (ollamaProvider) Auth() AuthRequirements { return AuthRequirements{} }
+
+func (ollamaProvider) DefaultEmbeddingModel() string { return "bge-m3" }
+
+func (p ollamaProvider) ListModels() ([]string, error) {
+	return getOllamaModels(withProvider(context.Background(), p.Name()))
+}
+
+func (ollamaProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	if err := ensureOllamaModel(ctx, model); err != nil {
+		return "", err
+	}
+	req := newOllamaChatRequest(model, messages)
+	return makeAPICall(ctx, ollamaURL()+"/api/chat", req, openAIHeaders(""), processOllamaChatResponse)
+}
+
+func (ollamaProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	if err := ensureOllamaModel(ctx, model); err != nil {
+		return "", err
+	}
+	req := newOllamaChatRequest(model, messages)
+	req.Stream = true
+	return makeNDJSONStreamingAPICall(ctx, ollamaURL()+"/api/chat", req, openAIHeaders(""), processOllamaStreamEvent, onDelta)
+}
+
+// ChatStructured passes the output schema as the format, which Ollama uses
+// to constrain the reply to matching JSON.
+func (ollamaProvider) ChatStructured(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput) (string, error) {
+	if err := ensureOllamaModel(ctx, model); err != nil {
+		return "", err
+	}
+	req := newOllamaChatRequest(model, messages)
+	req.Format = output.Schema
+	return makeAPICall(ctx, ollamaURL()+"/api/chat", req, openAIHeaders(""), processOllamaChatResponse)
+}
+
+func (ollamaProvider) ChatStructuredStream(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput, onDelta func(string)) (string, error) {
+	if err := ensureOllamaModel(ctx, model); err != nil {
+		return "", err
+	}
+	req := newOllamaChatRequest(model, messages)
+	req.Format = output.Schema
+	req.Stream = true
+	return makeNDJSONStreamingAPICall(ctx, ollamaURL()+"/api/chat", req, openAIHeaders(""), processOllamaStreamEvent, onDelta)
+}
+
+func (ollamaProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	if err := ensureOllamaModel(ctx, model); err != nil {
+		return nil, err
+	}
+	req := OllamaEmbedRequest{
+		Model:     model,
+		Input:     input,
+		KeepAlive: viper.GetString("ollama.keep_alive"),
+		Options:   OllamaOptions{NumCtx: viper.GetInt("ollama.num_ctx")},
+	}
+	return makeAPICall(ctx, ollamaURL()+"/api/embed", req, openAIHeaders(""), processOllamaEmbedResponse)
+}
+
+func ollamaURL() string {
+	baseURL := strings.TrimRight(viper.GetString("ollama.base_url"), "/")
+	if baseURL == "" {
+		return ollamaBaseURL
+	}
+	return baseURL
+}
+
+func newOllamaChatRequest(model string, messages []AIMessage) OllamaChatRequest {
+	req := OllamaChatRequest{
+		Model:     model,
+		Messages:  messages,
+		KeepAlive: viper.GetString("ollama.keep_alive"),
+		Options: OllamaOptions{
+			Temperature: temperature,
+			NumPredict:  maxTokens,
+			NumCtx:      viper.GetInt("ollama.num_ctx"),
+		},
+	}
+	if format := viper.GetString("ollama.format"); format != "" {
+		req.Format = format
+	}
+	return req
+}
+
+func processOllamaChatResponse(body []byte, usage *Usage) (string, error) {
+	var resp OllamaChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("Ollama error: %s", resp.Error)
+	}
+	if resp.Message.Content == "" {
+		return "", fmt.Errorf("The LLM returned an empty response")
+	}
+	usage.update(resp.PromptEvalCount, resp.EvalCount)
+	return resp.Message.Content, nil
+}
+
+func processOllamaStreamEvent(data []byte, usage *Usage) (string, error) {
+	var event OllamaChatResponse
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("Error unmarshaling stream event: %v", err)
+	}
+	if event.Error != "" {
+		return "", fmt.Errorf("Ollama error: %s", event.Error)
+	}
+	usage.update(event.PromptEvalCount, event.EvalCount)
+	return event.Message.Content, nil
+}
+
+func processOllamaEmbedResponse(body []byte, usage *Usage) ([]float32, error) {
+	var resp OllamaEmbedResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling embeddings response: %v", err)
+	}
+	if len(resp.Embeddings) == 0 || len(resp.Embeddings[0]) == 0 {
+		return nil, fmt.Errorf("No embeddings returned")
+	}
+	usage.PromptTokens = resp.PromptEvalCount
+	return resp.Embeddings[0], nil
+}
+
+func getOllamaModels(ctx context.Context) ([]string, error) {
+	var ollamaResp OllamaResponse
+	if err := getJSON(ctx, ollamaURL()+"/api/tags", nil, &ollamaResp); err != nil {
+		return nil, err
+	}
+
+	var models []string
+	for _, model := range ollamaResp.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
+
+func ensureOllamaModel(ctx context.Context, model string) error {
+	if _, ok := ollamaInstalledModels.Load(model); ok {
+		return nil
+	}
+	models, err := getOllamaModels(ctx)
+	if err != nil {
+		return fmt.Errorf("Error fetching Ollama models: %w", err)
+	}
+	for _, installed := range models {
+		if ollamaModelName(installed) == ollamaModelName(model) {
+			ollamaInstalledModels.Store(model, true)
+			return nil
+		}
+	}
+	if !viper.GetBool("ollama.auto_pull") {
+		return fmt.Errorf("Ollama model %s is not installed. Run 'ollama pull %s'", model, model)
+	}
+	fmt.Printf("Ollama model %s is not installed. Pulling it now...\n", model)
+	if err := pullOllamaModel(ctx, model); err != nil {
+		return err
+	}
+	ollamaInstalledModels.Store(model, true)
+	return nil
+}
+
+func ollamaModelName(model string) string {
+	if !strings.Contains(model, ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+func pullOllamaModel(ctx context.Context, model string) error {
+	resp, err := sendAPIRequest(ctx, ollamaURL()+"/api/pull", OllamaPullRequest{Model: model, Stream: true}, openAIHeaders(""))
+	if err != nil {
+		return fmt.Errorf("Error pulling Ollama model %s: %w", model, err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress OllamaPullProgress
+		if err := json.Unmarshal(scanner.Bytes(), &progress); err != nil {
+			continue
+		}
+		if progress.Error != "" {
+			fmt.Println()
+			return fmt.Errorf("Error pulling Ollama model %s: %s", model, progress.Error)
+		}
+		if progress.Total > 0 {
+			fmt.Printf("\r\033[K%s: %d%%", progress.Status, progress.Completed*100/progress.Total)
+		} else {
+			fmt.Printf("\r\033[K%s", progress.Status)
+		}
+		if progress.Status == "success" {
+			fmt.Println()
+			return nil
+		}
+	}
+	fmt.Println()
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Error pulling Ollama model %s: %w", model, err)
+	}
+	return fmt.Errorf("Ollama pull of %s ended before completing", model)
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type OpenAIRequest struct {
+	Model               string                `json:"model"`
+	Messages            []AIMessage           `json:"messages"`
+	MaxTokens           int                   `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                   `json:"max_completion_tokens,omitempty"`
+	Temperature         float64               `json:"temperature,omitempty"`
+	Stream              bool                  `json:"stream,omitempty"`
+	StreamOptions       *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat      *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+	Strict      bool        `json:"strict"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type OpenAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+type OpenAIStreamResponse struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+type OpenAIEmbeddingRequest struct {
+	Model string      `json:"model"`
+	Input interface{} `json:"input"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Object string `json:"object"`
+	Data   []struct {
+		Object    string    `json:"object"`
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+const openAIBaseURL = "https://api.openai.com"
+
+var openAIReasoningModelPattern = regexp.MustCompile(`^o\d`)
+
+type openAIProvider struct{}
+
+func init() {
+	registerProvider(openAIProvider{})
+}
+
+func (openAIProvider) Name() string { return "OpenAI" }
+
+func (openAIProvider) Auth() AuthRequirements {
+	return AuthRequirements{APIKeyEnv: "OPENAI_API_KEY"}
+}
+
+func (openAIProvider) DefaultEmbeddingModel() string { return "text-embedding-3-small" }
+
+func (p openAIProvider) ListModels() ([]string, error) {
+	return discoverModels(p.Name(), []string{"gpt-4o", "gpt-4o-mini"}, getOpenAIModels), nil
+}
+
+// getOpenAIModels lists the chat models, leaving out embedding, audio,
+// image and moderation models.
+func getOpenAIModels(ctx context.Context) ([]string, error) {
+	var resp OpenAIModelsResponse
+	if err := getJSON(ctx, openAIBaseURL+"/v1/models", openAIHeaders(getAPIKey("OpenAI")), &resp); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, model := range resp.Data {
+		if isOpenAIChatModel(model.ID) {
+			models = append(models, model.ID)
+		}
+	}
+	return models, nil
+}
+
+func isOpenAIChatModel(id string) bool {
+	if !strings.HasPrefix(id, "gpt-") && !strings.HasPrefix(id, "chatgpt-") && !openAIReasoningModelPattern.MatchString(id) {
+		return false
+	}
+	for _, excluded := range []string{"audio", "realtime", "tts", "transcribe", "image", "search", "instruct"} {
+		if strings.Contains(id, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (openAIProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	return openAIChat(ctx, openAIBaseURL+"/v1/chat/completions", openAIHeaders(apiKey), model, messages)
+}
+
+func (openAIProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	return openAIChatStream(ctx, openAIBaseURL+"/v1/chat/completions", openAIHeaders(apiKey), model, messages, true, onDelta)
+}
+
+func (openAIProvider) ChatStructured(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput) (string, error) {
+	return openAIChatStructured(ctx, openAIBaseURL+"/v1/chat/completions", openAIHeaders(apiKey), model, messages, output)
+}
+
+func (openAIProvider) ChatStructuredStream(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput, onDelta func(string)) (string, error) {
+	req := newOpenAIRequest(model, messages)
+	req.ResponseFormat = openAIJSONSchemaFormat(output)
+	req.Stream = true
+	req.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	return makeStreamingAPICall(ctx, openAIBaseURL+"/v1/chat/completions", req, openAIHeaders(apiKey), processLLMStreamEvent, onDelta)
+}
+
+func (openAIProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	return openAIEmbeddings(ctx, openAIBaseURL+"/v1/embeddings", openAIHeaders(apiKey), model, input)
+}
+
+func openAIHeaders(apiKey string) map[string]string {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+	return headers
+}
+
+// newOpenAIRequest sets the token limit and temperature. Reasoning models
+// (o1, o3, ...) take max_completion_tokens and only the default temperature.
+func newOpenAIRequest(model string, messages []AIMessage) OpenAIRequest {
+	req := OpenAIRequest{Model: model, Messages: messages}
+	if openAIReasoningModelPattern.MatchString(model) {
+		req.MaxCompletionTokens = maxTokens
+		return req
+	}
+	req.MaxTokens = maxTokens
+	req.Temperature = temperature
+	return req
+}
+
+func openAIChat(ctx context.Context, apiURL string, headers map[string]string, model string, messages []AIMessage) (string, error) {
+	req := newOpenAIRequest(model, messages)
+	return makeAPICall(ctx, apiURL, req, headers, processLLMResponse)
+}
+
+// openAIChatStructured asks for the output through a strict JSON schema
+// response format.
+func openAIChatStructured(ctx context.Context, apiURL string, headers map[string]string, model string, messages []AIMessage, output StructuredOutput) (string, error) {
+	req := newOpenAIRequest(model, messages)
+	req.ResponseFormat = openAIJSONSchemaFormat(output)
+	return makeAPICall(ctx, apiURL, req, headers, processLLMResponse)
+}
+
+func openAIJSONSchemaFormat(output StructuredOutput) *OpenAIResponseFormat {
+	return &OpenAIResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &OpenAIJSONSchema{
+			Name:        output.Name,
+			Description: output.Description,
+			Schema:      output.Schema,
+			Strict:      true,
+		},
+	}
+}
+
+// openAIChatStream streams a chat completion. includeUsage asks for a final
+// usage chunk, which not every OpenAI-compatible server accepts.
+func openAIChatStream(ctx context.Context, apiURL string, headers map[string]string, model string, messages []AIMessage, includeUsage bool, onDelta func(string)) (string, error) {
+	req := newOpenAIRequest(model, messages)
+	req.Stream = true
+	if includeUsage {
+		req.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	}
+	return makeStreamingAPICall(ctx, apiURL, req, headers, processLLMStreamEvent, onDelta)
+}
+
+func openAIEmbeddings(ctx context.Context, apiURL string, headers map[string]string, model, input string) ([]float32, error) {
+	req := OpenAIEmbeddingRequest{
+		Input: input,
+		Model: model,
+	}
+	return makeAPICall(ctx, apiURL, req, headers, processEmbeddingResponse)
+}
+
+func processLLMResponse(body []byte, usage *Usage) (string, error) {
+	var apiResp OpenAIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return "", fmt.Errorf("Error unmarshaling JSON: %v", err)
+	}
+	if len(apiResp.Choices) == 0 {
+		return "", fmt.Errorf("No choices in the API response")
+	}
+	*usage = apiResp.Usage
+	if refusal := apiResp.Choices[0].Message.Refusal; refusal != "" {
+		return "", fmt.Errorf("The LLM refused the request: %s", refusal)
+	}
+	return apiResp.Choices[0].Message.Content, nil
+}
+
+func processLLMStreamEvent(data []byte, usage *Usage) (string, error) {
+	var event OpenAIStreamResponse
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("Error unmarshaling stream event: %v", err)
+	}
+	usage.update(event.Usage.PromptTokens, event.Usage.CompletionTokens)
+	if len(event.Choices) == 0 {
+		return "", nil
+	}
+	return event.Choices[0].Delta.Content, nil
+}
+
+func processEmbeddingResponse(body []byte, usage *Usage) ([]float32, error) {
+	var resp OpenAIEmbeddingResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling embeddings response: %v", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("No embeddings returned")
+	}
+	usage.PromptTokens = resp.Usage.PromptTokens
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = resp.Usage.TotalTokens
+	}
+	return resp.Data[0].Embedding, nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+type OpenAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// openAICompatibleProvider talks to any server exposing the OpenAI REST API
+// (vLLM, llama.cpp server, LM Studio, ...). Connection details live under
+// the openai_compatible key in ai-config.yaml.
+type openAICompatibleProvider struct{}
+
+func init() {
+	registerProvider(openAICompatibleProvider{})
+}
+
+func (openAICompatibleProvider) Name() string { return "OpenAI-Compatible" }
+
+func (openAICompatibleProvider) Auth() AuthRequirements {
+	return AuthRequirements{
+		APIKeyEnv:      "OPENAI_COMPATIBLE_API_KEY",
+		OptionalAPIKey: true,
+		BaseURLKey:     "openai_compatible.base_url",
+	}
+}
+
+func (openAICompatibleProvider) DefaultEmbeddingModel() string {
+	return viper.GetString("openai_compatible.embedding_model")
+}
+
+func (p openAICompatibleProvider) ListModels() ([]string, error) {
+	baseURL, err := p.baseURL()
+	if err != nil {
+		return nil, err
+	}
+	var resp OpenAIModelsResponse
+	ctx := withProvider(context.Background(), p.Name())
+	if err := getJSON(ctx, baseURL+"/v1/models", p.headers(getAPIKey(p.Name())), &resp); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, model := range resp.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func (p openAICompatibleProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	baseURL, err := p.baseURL()
+	if err != nil {
+		return "", err
+	}
+	return openAIChat(ctx, baseURL+"/v1/chat/completions", p.headers(apiKey), model, messages)
+}
+
+func (p openAICompatibleProvider) ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error) {
+	baseURL, err := p.baseURL()
+	if err != nil {
+		return "", err
+	}
+	return openAIChatStream(ctx, baseURL+"/v1/chat/completions", p.headers(apiKey), model, messages, false, onDelta)
+}
+
+func (p openAICompatibleProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	baseURL, err := p.baseURL()
+	if err != nil {
+		return nil, err
+	}
+	return openAIEmbeddings(ctx, baseURL+"/v1/embeddings", p.headers(apiKey), model, input)
+}
+
+func (openAICompatibleProvider) baseURL() (string, error) {
+	baseURL := strings.TrimRight(viper.GetString("openai_compatible.base_url"), "/")
+	baseURL = strings.TrimSuffix(baseURL, "/v1")
+	if baseURL == "" {
+		return "", fmt.Errorf("OpenAI-compatible base URL not set. Use 'ai config' or set openai_compatible.base_url in %s", configFileName)
+	}
+	return baseURL, nil
+}
+
+func (openAICompatibleProvider) headers(apiKey string) map[string]string {
+	headers := map[string]string{"Content-Type": "application/json"}
+	for key, value := range viper.GetStringMapString("openai_compatible.headers") {
+		headers[key] = value
+	}
+	if apiKey != "" {
+		authHeader := viper.GetString("openai_compatible.auth_header")
+		if authHeader == "" || strings.EqualFold(authHeader, "Authorization") {
+			headers["Authorization"] = "Bearer " + apiKey
+		} else {
+			headers[authHeader] = apiKey
+		}
+	}
+	return headers
+}
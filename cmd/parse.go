@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var ErrNoCommand = errors.New("no command found in the response")
+
+const reformatPrompt = "I could not find a command in your reply. Reply with only the command inside <command></command> tags."
+
+var (
+	commandTagPattern = regexp.MustCompile(`(?is)<command(?:\s[^>]*)?>(.*?)</command>`)
+	codeFencePattern  = regexp.MustCompile("(?s)```([\\w+-]*)[^\\n]*\\n(.*?)```")
+	markupPattern     = regexp.MustCompile(`<[^>]+>`)
+)
+
+var shellFenceLanguages = map[string]bool{
+	"": true, "bash": true, "sh": true, "shell": true, "zsh": true, "fish": true,
+	"console": true, "shell-session": true, "sh-session": true,
+	"powershell": true, "pwsh": true, "ps1": true, "cmd": true, "bat": true,
+}
+
+// parseCommands returns the commands in a reply, in order. Structured JSON
+// replies hold a list of candidates or a single command; free-text replies
+// may contain several <command> tags or shell code fences surrounded by
+// prose.
+func parseCommands(text string) ([]Command, error) {
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") {
+		var reply struct {
+			Candidates []Command `json:"candidates"`
+		}
+		if err := json.Unmarshal([]byte(trimmed), &reply); err == nil && len(reply.Candidates) > 0 {
+			var commands []Command
+			for _, cmd := range reply.Candidates {
+				if cmd = cleanStructuredCommand(cmd); cmd.Content != "" {
+					commands = append(commands, cmd)
+				}
+			}
+			if len(commands) > 0 {
+				return commands, nil
+			}
+		}
+		var cmd Command
+		if err := json.Unmarshal([]byte(trimmed), &cmd); err == nil {
+			if cmd = cleanStructuredCommand(cmd); cmd.Content != "" {
+				return []Command{cmd}, nil
+			}
+		}
+	}
+
+	commands := extractCommands(text)
+	if len(commands) == 0 {
+		return nil, ErrNoCommand
+	}
+	return commands, nil
+}
+
+func cleanStructuredCommand(cmd Command) Command {
+	if inner := extractCommands(cmd.Content); len(inner) > 0 {
+		cmd.Content = inner[0].Content
+	}
+	cmd.Content = strings.TrimSpace(cmd.Content)
+	return cmd
+}
+
+// extractCommands finds the contents of <command> tags anywhere in the text
+// or, when there are none, of shell code fences. The first line of prose
+// after a command is kept as its explanation.
+func extractCommands(text string) []Command {
+	var commands []Command
+	matches := commandTagPattern.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range matches {
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if content := cleanCommand(text[match[2]:match[3]]); content != "" {
+			commands = append(commands, Command{Content: content, Explanation: firstLine(text[match[1]:end])})
+		}
+	}
+	if len(commands) > 0 {
+		return commands
+	}
+	matches = codeFencePattern.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range matches {
+		if !shellFenceLanguages[strings.ToLower(text[match[2]:match[3]])] {
+			continue
+		}
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		if content := stripPrompts(text[match[4]:match[5]]); content != "" {
+			commands = append(commands, Command{Content: content, Explanation: firstLine(text[match[1]:end])})
+		}
+	}
+	return commands
+}
+
+// firstLine returns the first non-empty line of text without markup.
+func firstLine(text string) string {
+	for _, line := range strings.Split(markupPattern.ReplaceAllString(text, ""), "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "-*: ")
+		if line != "" {
+			return html.UnescapeString(line)
+		}
+	}
+	return ""
+}
+
+// cleanCommand unwraps CDATA sections, which are taken literally, and
+// otherwise decodes HTML entities. A code fence or backticks around the
+// command are removed.
+func cleanCommand(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "<![CDATA[") && strings.HasSuffix(content, "]]>") {
+		content = strings.TrimSuffix(strings.TrimPrefix(content, "<![CDATA["), "]]>")
+	} else {
+		content = html.UnescapeString(content)
+	}
+	content = strings.TrimSpace(content)
+	if match := codeFencePattern.FindStringSubmatch(content); match != nil {
+		return stripPrompts(match[2])
+	}
+	if len(content) > 1 && strings.HasPrefix(content, "`") && strings.HasSuffix(content, "`") {
+		content = strings.Trim(content, "`")
+	}
+	return strings.TrimSpace(content)
+}
+
+// stripPrompts removes the "$ " shell prompt that models sometimes copy
+// into code fences.
+func stripPrompts(block string) string {
+	lines := strings.Split(strings.TrimSpace(block), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, "$ ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Command
+	}{
+		{
+			name: "bare tag",
+			text: "<command>ls -la</command>",
+			want: []Command{{Content: "ls -la"}},
+		},
+		{
+			name: "prose around the tag",
+			text: "Sure! Here you go:\n<command>du -sh *</command>\nShows the size of each entry.\nHope that helps.",
+			want: []Command{{Content: "du -sh *", Explanation: "Shows the size of each entry."}},
+		},
+		{
+			name: "tag with attributes and odd case",
+			text: `<Command lang="sh">pwd</COMMAND>`,
+			want: []Command{{Content: "pwd"}},
+		},
+		{
+			name: "several tags",
+			text: "<command>ls</command>\n- Lists files\n<command>ls -a</command>\n- Includes hidden files",
+			want: []Command{
+				{Content: "ls", Explanation: "Lists files"},
+				{Content: "ls -a", Explanation: "Includes hidden files"},
+			},
+		},
+		{
+			name: "empty tag is skipped",
+			text: "<command> </command><command>whoami</command>",
+			want: []Command{{Content: "whoami"}},
+		},
+		{
+			name: "HTML entities",
+			text: "<command>grep -r &quot;TODO&quot; . &amp;&amp; echo done &gt; out.txt</command>",
+			want: []Command{{Content: `grep -r "TODO" . && echo done > out.txt`}},
+		},
+		{
+			name: "CDATA is taken literally",
+			text: "<command><![CDATA[echo '&amp;' | cat && ls <dir>]]></command>",
+			want: []Command{{Content: "echo '&amp;' | cat && ls <dir>"}},
+		},
+		{
+			name: "inline backticks inside the tag",
+			text: "<command>`git status`</command>",
+			want: []Command{{Content: "git status"}},
+		},
+		{
+			name: "code fence inside the tag",
+			text: "<command>\n```bash\n$ git log --oneline\n```\n</command>",
+			want: []Command{{Content: "git log --oneline"}},
+		},
+		{
+			name: "bash fence without tags",
+			text: "Run this:\n```bash\n$ find . -name '*.go'\n```\nIt searches recursively.",
+			want: []Command{{Content: "find . -name '*.go'", Explanation: "It searches recursively."}},
+		},
+		{
+			name: "unlabelled fence",
+			text: "```\ndf -h\n```",
+			want: []Command{{Content: "df -h"}},
+		},
+		{
+			name: "non-shell fences are skipped",
+			text: "```python\nprint('hi')\n```\n```sh\necho hi\n```",
+			want: []Command{{Content: "echo hi"}},
+		},
+		{
+			name: "tags win over fences",
+			text: "```bash\nrm -rf build\n```\n<command>make clean</command>",
+			want: []Command{{Content: "make clean"}},
+		},
+		{
+			name: "structured candidates",
+			text: `{"candidates":[{"command":"ls","explanation":"List","risk_level":"low"},{"command":" ","explanation":"blank"},{"command":"<command>ls -a</command>"}]}`,
+			want: []Command{
+				{Content: "ls", Explanation: "List", RiskLevel: "low"},
+				{Content: "ls -a"},
+			},
+		},
+		{
+			name: "structured single command",
+			text: `{"command":"uptime","requires_sudo":false,"assumptions":["Linux"]}`,
+			want: []Command{{Content: "uptime", Assumptions: []string{"Linux"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommands(tt.text)
+			if err != nil {
+				t.Fatalf("parseCommands: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCommandsNoCommand(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"I can't help with that.",
+		"Use the `ls` command.",
+		"<command></command>",
+		"<command>ls",
+		"```python\nimport os\n```",
+		`{"candidates":[]}`,
+		`{"command":""}`,
+	} {
+		if _, err := parseCommands(text); !errors.Is(err, ErrNoCommand) {
+			t.Errorf("parseCommands(%q) error = %v, want ErrNoCommand", text, err)
+		}
+	}
+}
+
+func TestCommandRendererChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "tags split across chunks",
+			chunks: []string{"Here: <comm", "and>git st", "atus</com", "mand> done"},
+			want:   "Generated command: git status\n",
+		},
+		{
+			name:   "one character at a time",
+			chunks: strings.Split("<command>ls -la</command>", ""),
+			want:   "Generated command: ls -la\n",
+		},
+		{
+			name:   "text after the command is ignored",
+			chunks: []string{"<command>pwd</command>", "<command>ls</command>"},
+			want:   "Generated command: pwd\n",
+		},
+		{
+			name:   "no tag prints nothing",
+			chunks: []string{"I'm not sure", " what you mean."},
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			r := newCommandRenderer(&out)
+			for _, chunk := range tt.chunks {
+				r.Write(chunk)
+			}
+			r.Finish()
+			if got := out.String(); got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
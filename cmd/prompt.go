@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultSystemPrompt = "Translate the following text command to a CLI command for {{.OS}}. {{with .Environment}}The environment is: {{.}}. {{end}}The current working directory is {{.Cwd}}. Output the command within XML tags like this: <command>CLI command</command>"
+
+var defaultPromptTools = []string{"git", "docker", "podman", "kubectl", "jq", "yq", "rg", "fd", "fdfind", "fzf", "curl", "wget", "python3", "node", "gsed", "gawk"}
+
+// PromptTemplate is a system prompt override. Template takes precedence
+// over File. Entries in "prompt.providers" apply to one provider.
+type PromptTemplate struct {
+	Provider string `mapstructure:"provider"`
+	Template string `mapstructure:"template"`
+	File     string `mapstructure:"file"`
+}
+
+// PromptData holds the variables available to system prompt templates.
+// Environment summarizes the fingerprint fields in one line.
+type PromptData struct {
+	OS             string
+	Distro         string
+	Kernel         string
+	Shell          string
+	ShellVersion   string
+	PackageManager string
+	Coreutils      string
+	Cwd            string
+	User           string
+	Date           string
+	Provider       string
+	Tools          []string
+	Environment    string
+}
+
+type commandPromptKey struct{}
+
+// withCommandPrompt records the rendered command prompt, so that each
+// provider in a fallback chain or race gets its own override. Other calls
+// made with ctx, such as explanations, keep their system message.
+func withCommandPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, commandPromptKey{}, prompt)
+}
+
+func commandPromptMessages(ctx context.Context, provider string, messages []AIMessage) ([]AIMessage, error) {
+	rendered, _ := ctx.Value(commandPromptKey{}).(string)
+	if rendered == "" || len(messages) == 0 || messages[0].Role != "system" || messages[0].Content != rendered {
+		return messages, nil
+	}
+	prompt, err := systemPromptFor(provider)
+	if err != nil {
+		return nil, err
+	}
+	return append([]AIMessage{{Role: "system", Content: prompt}}, messages[1:]...), nil
+}
+
+// promptSource returns the template for provider and where it came from:
+// the provider's override, the global template or file, the
+// system_prompt.tmpl file next to the config, or the built-in prompt.
+func promptSource(provider string) (string, string, error) {
+	var overrides []PromptTemplate
+	if err := viper.UnmarshalKey("prompt.providers", &overrides); err != nil {
+		return "", "", fmt.Errorf("Invalid prompt.providers configuration: %v", err)
+	}
+	chosen := PromptTemplate{
+		Template: viper.GetString("prompt.template"),
+		File:     viper.GetString("prompt.file"),
+	}
+	for _, override := range overrides {
+		if strings.EqualFold(override.Provider, provider) {
+			chosen = override
+			break
+		}
+	}
+
+	if chosen.Template != "" {
+		return chosen.Template, "config", nil
+	}
+	path := chosen.File
+	if path == "" {
+		path = filepath.Join(storeDir, promptFileName)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return defaultSystemPrompt, "built-in", nil
+		}
+	}
+	path = expandHome(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading prompt template: %v", err)
+	}
+	return string(data), path, nil
+}
+
+func systemPromptFor(provider string) (string, error) {
+	text, source, err := promptSource(provider)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New("prompt").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Invalid prompt template (%s): %v", source, err)
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, newPromptData(provider)); err != nil {
+		return "", fmt.Errorf("Invalid prompt template (%s): %v", source, err)
+	}
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+func newPromptData(provider string) PromptData {
+	data := PromptData{
+		OS:       osInfo,
+		Shell:    shellName(),
+		Cwd:      currentDir,
+		Date:     time.Now().Format("2006-01-02"),
+		Provider: provider,
+	}
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	}
+	if viper.GetBool("fingerprint.enabled") {
+		f := loadFingerprint()
+		data.Distro = f.Distro
+		data.Kernel = f.Kernel
+		data.Shell = f.Shell
+		data.ShellVersion = f.ShellVersion
+		data.PackageManager = f.PackageManager
+		data.Coreutils = f.Coreutils
+		data.Tools = f.Tools
+		data.Environment = f.Summary()
+	} else {
+		data.Distro = distro()
+		data.Tools = availableTools()
+	}
+	return data
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Inspect the system prompt",
+}
+
+var promptShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Render the system prompt",
+	Long:  `Render the system prompt template for a provider with the current environment.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeStore()
+		provider, _ := cmd.Flags().GetString("provider")
+		if provider == "" {
+			provider = viper.GetString("provider")
+		}
+		for _, name := range providerOrder {
+			if strings.EqualFold(name, provider) {
+				provider = name
+			}
+		}
+		prompt, err := systemPromptFor(provider)
+		if err != nil {
+			return err
+		}
+		fmt.Println(prompt)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(promptCmd)
+	promptCmd.AddCommand(promptShowCmd)
+	promptShowCmd.Flags().String("provider", "", "Render the prompt for this provider instead of the configured one")
+}
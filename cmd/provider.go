@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// AuthRequirements describes the credentials and connection settings a
+// provider needs. An empty APIKeyEnv means the provider works without an
+// API key; OptionalAPIKey means one is sent only when configured.
+// BaseURLLabel names the BaseURLKey setting in the config menu and
+// defaults to "base URL".
+type AuthRequirements struct {
+	APIKeyEnv      string
+	OptionalAPIKey bool
+	AccountIDKey   string
+	AccountIDEnv   string
+	BaseURLKey     string
+	BaseURLLabel   string
+}
+
+// Provider is implemented by every LLM backend. Adding a backend means
+// adding a type that implements it and registering it from an init func.
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error)
+	Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error)
+	DefaultEmbeddingModel() string
+	ListModels() ([]string, error)
+	Auth() AuthRequirements
+}
+
+// StreamingProvider is implemented by providers that can stream chat
+// completions. onDelta receives each chunk of text as it arrives.
+type StreamingProvider interface {
+	ChatStream(ctx context.Context, model, apiKey string, messages []AIMessage, onDelta func(string)) (string, error)
+}
+
+// capabilityProvider is implemented by providers that support only chat or
+// only embeddings, so they can be left out of the matching config lists.
+type capabilityProvider interface {
+	SupportsChat() bool
+	SupportsEmbeddings() bool
+}
+
+var (
+	providers     = map[string]Provider{}
+	providerOrder []string
+)
+
+func registerProvider(p Provider) {
+	if _, exists := providers[p.Name()]; exists {
+		panic(fmt.Sprintf("Provider %s registered twice", p.Name()))
+	}
+	providers[p.Name()] = p
+	providerOrder = append(providerOrder, p.Name())
+}
+
+func getProvider(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported provider: %s", name)
+	}
+	return p, nil
+}
+
+func supportsChat(p Provider) bool {
+	if c, ok := p.(capabilityProvider); ok {
+		return c.SupportsChat()
+	}
+	return true
+}
+
+func supportsEmbeddings(p Provider) bool {
+	if c, ok := p.(capabilityProvider); ok {
+		return c.SupportsEmbeddings()
+	}
+	return true
+}
+
+func chatProviderNames() []string {
+	var names []string
+	for _, name := range providerOrder {
+		if supportsChat(providers[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func embeddingProviderNames() []string {
+	var names []string
+	for _, name := range providerOrder {
+		if supportsEmbeddings(providers[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func apiKeyConfigKey(provider string) string {
+	return "api_keys." + strings.ToLower(provider)
+}
+
+func requiresAPIKey(provider string) bool {
+	if replayingCassette() {
+		return false
+	}
+	p, err := getProvider(provider)
+	if err != nil {
+		return true
+	}
+	auth := p.Auth()
+	return auth.APIKeyEnv != "" && !auth.OptionalAPIKey
+}
+
+func optionalAPIKey(provider string) bool {
+	p, err := getProvider(provider)
+	if err != nil {
+		return false
+	}
+	return p.Auth().OptionalAPIKey
+}
+
+func requiresAccountID(provider string) bool {
+	p, err := getProvider(provider)
+	if err != nil {
+		return false
+	}
+	return p.Auth().AccountIDKey != ""
+}
+
+func requiresBaseURL(provider string) bool {
+	p, err := getProvider(provider)
+	if err != nil {
+		return false
+	}
+	return p.Auth().BaseURLKey != ""
+}
+
+func baseURLLabel(provider string) string {
+	p, err := getProvider(provider)
+	if err != nil || p.Auth().BaseURLLabel == "" {
+		return "base URL"
+	}
+	return p.Auth().BaseURLLabel
+}
+
+func getBaseURL(provider string) string {
+	p, err := getProvider(provider)
+	if err != nil || p.Auth().BaseURLKey == "" {
+		return ""
+	}
+	return viper.GetString(p.Auth().BaseURLKey)
+}
+
+func saveBaseURL(provider string, baseURL string) {
+	p, err := getProvider(provider)
+	if err != nil || p.Auth().BaseURLKey == "" || baseURL == "" {
+		return
+	}
+	viper.Set(p.Auth().BaseURLKey, baseURL)
+}
+
+func apiKeyAvailable(provider string) bool {
+	p, err := getProvider(provider)
+	if err != nil {
+		return false
+	}
+	auth := p.Auth()
+	return auth.APIKeyEnv == "" || os.Getenv(auth.APIKeyEnv) != ""
+}
+
+func saveAPIKey(provider string, apiKey string, accountID string) {
+	p, err := getProvider(provider)
+	if err != nil {
+		return
+	}
+	auth := p.Auth()
+	if apiKey != "" && auth.APIKeyEnv != "" {
+		viper.Set(apiKeyConfigKey(provider), apiKey)
+	}
+	if accountID != "" && auth.AccountIDKey != "" {
+		viper.Set(auth.AccountIDKey, accountID)
+	}
+}
+
+func getAPIKey(provider string) string {
+	p, err := getProvider(provider)
+	if err != nil {
+		return ""
+	}
+	auth := p.Auth()
+	if auth.APIKeyEnv == "" {
+		return ""
+	}
+	key := viper.GetString(apiKeyConfigKey(provider))
+	if key == "" {
+		key = os.Getenv(auth.APIKeyEnv)
+	}
+	return key
+}
+
+func getAccountID(provider string) string {
+	p, err := getProvider(provider)
+	if err != nil {
+		return ""
+	}
+	auth := p.Auth()
+	if auth.AccountIDKey == "" {
+		return ""
+	}
+	accountID := viper.GetString(auth.AccountIDKey)
+	if accountID == "" && auth.AccountIDEnv != "" {
+		accountID = os.Getenv(auth.AccountIDEnv)
+	}
+	return accountID
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrAuthFailed  = errors.New("authentication failed")
+	ErrBadRequest  = errors.New("bad request")
+	ErrServerError = errors.New("server error")
+	ErrNetwork     = errors.New("network error")
+)
+
+// APIError is returned for failed provider calls. Kind is one of the Err*
+// sentinels above, so callers can use errors.Is(err, ErrRateLimited).
+type APIError struct {
+	Kind       error
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("Error sending request: %v", e.Err)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) retryable() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrServerError || e.Kind == ErrNetwork
+}
+
+func newStatusError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: retryAfter(resp.Header, time.Now()),
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		apiErr.Kind = ErrRateLimited
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		apiErr.Kind = ErrAuthFailed
+	case resp.StatusCode >= 500:
+		apiErr.Kind = ErrServerError
+	default:
+		apiErr.Kind = ErrBadRequest
+	}
+	return apiErr
+}
+
+// retryAfter reads how long the server asked us to wait, from Retry-After
+// or the OpenAI and Anthropic rate-limit reset headers.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	if ms := header.Get("retry-after-ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if t, err := http.ParseTime(value); err == nil {
+			return t.Sub(now)
+		}
+	}
+
+	var wait time.Duration
+	for _, key := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		if d, err := time.ParseDuration(header.Get(key)); err == nil && d > wait {
+			wait = d
+		}
+	}
+	for _, key := range []string{"anthropic-ratelimit-requests-reset", "anthropic-ratelimit-tokens-reset"} {
+		if t, err := time.Parse(time.RFC3339, header.Get(key)); err == nil && t.Sub(now) > wait {
+			wait = t.Sub(now)
+		}
+	}
+	return wait
+}
+
+// maxRetryBackoff caps the backoff when retry.max_delay is not set.
+const maxRetryBackoff = 5 * time.Minute
+
+// retryDelay returns the wait before the given retry attempt: the server's
+// requested delay if any, otherwise jittered exponential backoff.
+func retryDelay(attempt int, serverDelay time.Duration) time.Duration {
+	if serverDelay > 0 {
+		return serverDelay + time.Duration(rand.Int63n(int64(250*time.Millisecond)))
+	}
+	base := viper.GetDuration("retry.base_delay")
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	maxDelay := viper.GetDuration("retry.max_delay")
+	if maxDelay <= 0 {
+		maxDelay = maxRetryBackoff
+	}
+	// Double one step at a time so large attempts cannot overflow.
+	backoff := base
+	for i := 1; i < attempt && backoff < maxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxDelay)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func describeAPIError(provider string, err error) string {
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrMissingAPIKey):
+		return fmt.Sprintf("Error: API key not set for provider %s. Use 'ai config' or set the appropriate environment variable.", provider)
+	case errors.Is(err, ErrBudgetExceeded):
+		return fmt.Sprintf("Not calling %s: %v. Raise the budget in ai-config.yaml or wait for it to reset.", provider, err)
+	case errors.Is(err, context.Canceled):
+		return fmt.Sprintf("Request to %s cancelled.", provider)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Sprintf("Request to %s timed out.", provider)
+	case errors.Is(err, ErrAuthFailed):
+		return fmt.Sprintf("Authentication with %s failed. Check your API key with 'ai config'.", provider)
+	case errors.Is(err, ErrRateLimited) && errors.As(err, &apiErr) && apiErr.RetryAfter > 0:
+		return fmt.Sprintf("%s rate limit exceeded. Try again in %s.", provider, apiErr.RetryAfter.Round(time.Second))
+	case errors.Is(err, ErrRateLimited):
+		return fmt.Sprintf("%s rate limit exceeded. Try again later.", provider)
+	case errors.Is(err, ErrServerError):
+		return fmt.Sprintf("%s is having problems: %v", provider, err)
+	case errors.Is(err, ErrNetwork):
+		return fmt.Sprintf("Could not reach %s: %v", provider, err)
+	case errors.Is(err, ErrBadRequest):
+		return fmt.Sprintf("%s rejected the request: %v", provider, err)
+	}
+	return fmt.Sprintf("Error calling %s API: %v", provider, err)
+}
@@ -2,26 +2,37 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"go/build"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	usearch "github.com/unum-cloud/usearch/golang"
 
 	badger "github.com/dgraph-io/badger/v4"
 )
 
 const (
-	configFileName = "ai-config.yaml"
-	cacheFileName  = "ai_cache.json"
-	indexFileName  = "index.usearch"
+	configFileName      = "ai-config.yaml"
+	cacheFileName       = "ai_cache.json"
+	indexFileName       = "index.usearch"
+	circuitFileName     = "circuit_breaker.json"
+	usageFileName       = "usage_ledger.jsonl"
+	cassetteFileName    = "cassette.json"
+	localRulesFileName  = "local_rules.yaml"
+	logFileName         = "ai.log"
+	modelsCacheFileName = "models_cache.json"
+	hedgeStatsFileName  = "hedge_stats.json"
+	promptFileName      = "system_prompt.tmpl"
+	fingerprintFileName = "env_fingerprint.json"
 )
 
 var (
@@ -36,8 +47,6 @@ var (
 	vectorSize           int
 )
 
-var systemPrompt = fmt.Sprintf("Translate the following text command to a CLI command for %s. The current working directory is %s. Output the command within XML tags like this: <command>CLI command</command>", osInfo, currentDir)
-
 var cfgFile string
 
 var rootCmd = &cobra.Command{
@@ -63,6 +72,18 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.TraverseChildren = true
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "Configuration Menu", "Open the configuration menu")
+	rootCmd.Flags().Int("candidates", 0, "Number of alternative commands to choose from")
+	viper.BindPFlag("candidates", rootCmd.Flags().Lookup("candidates"))
+	rootCmd.Flags().Bool("hedge", false, "Send the request to several providers at once and use the fastest reply")
+	viper.BindPFlag("hedge.enabled", rootCmd.Flags().Lookup("hedge"))
+	rootCmd.PersistentFlags().String("cassette-mode", "", "Record provider calls to a cassette or replay them: record or replay")
+	rootCmd.PersistentFlags().String("cassette", "", "Cassette file for --cassette-mode")
+	viper.BindPFlag("cassette.mode", rootCmd.PersistentFlags().Lookup("cassette-mode"))
+	viper.BindPFlag("cassette.file", rootCmd.PersistentFlags().Lookup("cassette"))
+	rootCmd.PersistentFlags().Bool("verbose", false, "Log every provider request with its status and latency")
+	rootCmd.PersistentFlags().Bool("debug", false, "Also log request and response headers and bodies, with API keys masked")
+	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
 }
 
 func getDir() (string, string) {
@@ -102,26 +123,6 @@ func initBadgerDB() error {
 	return nil
 }
 
-func initIndex() {
-	vectorSize := viper.GetInt("vector_size")
-	conf := usearch.DefaultConfig(uint(vectorSize))
-	var err error
-	index, err = usearch.NewIndex(conf)
-
-	if err != nil {
-		panic(fmt.Sprintf("Failed to create Index: %v", err))
-	}
-	err = index.Load(indexFile)
-	if err == nil {
-		return
-	}
-	err = index.Save(indexFile)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to save index: %v", err))
-	}
-	fmt.Println("New index created and saved successfully.")
-}
-
 func initConfig() {
 	viper.SetConfigName(configFileName)
 	viper.SetConfigType("yaml")
@@ -133,8 +134,32 @@ func initConfig() {
 	viper.SetDefault("vector_size", 1536)
 	viper.SetDefault("max_tokens", 1000)
 	viper.SetDefault("temperature", 0.1)
+	viper.SetDefault("stream", true)
+	viper.SetDefault("structured_output", true)
+	viper.SetDefault("candidates", 1)
+	viper.SetDefault("explain_before_confirm", false)
+	viper.SetDefault("local_embeddings.fallback", true)
+	viper.SetDefault("local_embeddings.max_distance", 0.2)
+	viper.SetDefault("log.output", "stderr")
+	viper.SetDefault("log.max_size", 10)
+	viper.SetDefault("log.max_backups", 3)
+	viper.SetDefault("models.cache_ttl", "24h")
+	viper.SetDefault("command_shell", "sh")
+	viper.SetDefault("fingerprint.enabled", true)
+	viper.SetDefault("fingerprint.ttl", "168h")
+	viper.SetDefault("anthropic.prompt_caching", true)
+	viper.SetDefault("ollama.auto_pull", true)
+	viper.SetDefault("retry.max_attempts", 4)
+	viper.SetDefault("retry.base_delay", "500ms")
+	viper.SetDefault("retry.max_delay", "30s")
+	viper.SetDefault("timeouts.connect", "10s")
+	viper.SetDefault("timeouts.request", "120s")
+	viper.SetDefault("circuit_breaker.failure_threshold", 2)
+	viper.SetDefault("circuit_breaker.cooldown", "5m")
 
 	viper.AutomaticEnv()
+	viper.BindEnv("cassette.mode", "AI_CASSETTE_MODE")
+	viper.BindEnv("cassette.file", "AI_CASSETTE")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -144,6 +169,8 @@ func initConfig() {
 		}
 	}
 
+	initLogging()
+
 	maxTokens = viper.GetInt("max_tokens")
 	temperature = viper.GetFloat64("temperature")
 	k = viper.GetInt("k")
@@ -153,7 +180,6 @@ func initConfig() {
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize BadgerDB: %v", err))
 	}
-	initIndex()
 }
 
 func execute(args []string) {
@@ -168,14 +194,40 @@ func execute(args []string) {
 		cmdInput, err := reader.ReadString('\n')
 		if err != nil {
 			fmt.Println("Error reading input:", err)
-			os.Exit(1)
+			exit(1)
 		}
 		fullCommand = strings.TrimSpace(cmdInput)
 	}
 
-	executeCommand(fullCommand)
-	defer db.Close()
-	defer index.Destroy()
+	defer closeStore()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Restore the default handler after the first signal, so a second
+	// Ctrl-C quits even if a command or request does not stop.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	executeCommand(ctx, fullCommand)
+}
+
+func closeStore() {
+	closeLogging()
+	if db != nil {
+		db.Close()
+		db = nil
+	}
+	for embedder, index := range indexes {
+		index.Destroy()
+		delete(indexes, embedder)
+	}
+}
+
+// exit closes Badger and the vector index before terminating, since
+// os.Exit skips deferred calls.
+func exit(code int) {
+	closeStore()
+	os.Exit(code)
 }
 
 func openFileExplorer(path string) error {
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	commandOpenTag  = "<command>"
+	commandCloseTag = "</command>"
+)
+
+func makeStreamingAPICall(ctx context.Context, apiURL string, req interface{}, headers map[string]string, processEvent func([]byte, *Usage) (string, error), onDelta func(string)) (string, error) {
+	return streamAPICall(ctx, apiURL, req, headers, sseEventData, processEvent, onDelta)
+}
+
+func makeNDJSONStreamingAPICall(ctx context.Context, apiURL string, req interface{}, headers map[string]string, processEvent func([]byte, *Usage) (string, error), onDelta func(string)) (string, error) {
+	return streamAPICall(ctx, apiURL, req, headers, ndjsonEventData, processEvent, onDelta)
+}
+
+func streamAPICall(ctx context.Context, apiURL string, req interface{}, headers map[string]string, eventData func([]byte) ([]byte, bool), processEvent func([]byte, *Usage) (string, error), onDelta func(string)) (string, error) {
+	ctx, cancel := withRequestTimeout(ctx)
+	defer cancel()
+	resp, err := sendAPIRequest(ctx, apiURL, req, headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, done := eventData(scanner.Bytes())
+		if done {
+			break
+		}
+		if len(data) == 0 {
+			continue
+		}
+		delta, err := processEvent(data, &usage)
+		if err != nil {
+			return text.String(), err
+		}
+		if delta != "" {
+			text.WriteString(delta)
+			onDelta(delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return text.String(), fmt.Errorf("Error reading stream: %v", err)
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("The LLM returned an empty response")
+	}
+	reportUsage(ctx, usage)
+	return text.String(), nil
+}
+
+func sseEventData(line []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return nil, false
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	return data, string(data) == "[DONE]"
+}
+
+func ndjsonEventData(line []byte) ([]byte, bool) {
+	return bytes.TrimSpace(line), false
+}
+
+var jsonCommandKey = regexp.MustCompile(`"command"\s*:\s*"`)
+
+// commandRenderer prints the contents of the <command> tag, or of the
+// "command" field of structured output, while the response is still
+// streaming in.
+type commandRenderer struct {
+	out     io.Writer
+	buf     strings.Builder
+	printed int
+	shown   string
+	started bool
+	done    bool
+}
+
+func newCommandRenderer(out io.Writer) *commandRenderer {
+	return &commandRenderer{out: out}
+}
+
+func (r *commandRenderer) Write(delta string) {
+	if r.done {
+		return
+	}
+	r.buf.WriteString(delta)
+	content, ok := r.command(r.buf.String())
+	if !ok {
+		return
+	}
+	if !r.started {
+		fmt.Fprint(r.out, "Generated command: ")
+		r.started = true
+	}
+	fmt.Fprint(r.out, content[r.printed:])
+	r.printed = len(content)
+	r.shown = content
+}
+
+// command returns the part of the command received so far.
+func (r *commandRenderer) command(text string) (string, bool) {
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		loc := jsonCommandKey.FindStringIndex(text)
+		if loc == nil {
+			return "", false
+		}
+		content, complete := partialJSONString(text[loc[1]:])
+		r.done = complete
+		return content, true
+	}
+	start := strings.Index(text, commandOpenTag)
+	if start < 0 {
+		return "", false
+	}
+	content := text[start+len(commandOpenTag):]
+	if end := strings.Index(content, commandCloseTag); end >= 0 {
+		r.done = true
+		return content[:end], true
+	}
+	return trimPartialTag(content, commandCloseTag), true
+}
+
+// partialJSONString decodes the body of a JSON string that may be cut off,
+// stopping before an incomplete escape. complete is true once the closing
+// quote has arrived.
+func partialJSONString(s string) (value string, complete bool) {
+	end := len(s)
+scan:
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			end, complete = i, true
+			break scan
+		case '\\':
+			n := 2
+			if strings.HasPrefix(s[i+1:], "u") {
+				n = 6
+				// A high surrogate only decodes with the low one after it.
+				if len(s) > i+3 && strings.ContainsRune("dD", rune(s[i+2])) && strings.ContainsRune("89abAB", rune(s[i+3])) {
+					n = 12
+				}
+			}
+			if i+n > len(s) {
+				end = i
+				break scan
+			}
+			i += n - 1
+		}
+	}
+	json.Unmarshal([]byte(`"`+s[:end]+`"`), &value)
+	return value, complete
+}
+
+func (r *commandRenderer) Finish() {
+	if r.started {
+		fmt.Fprintln(r.out)
+	}
+}
+
+// Rendered reports whether command was already printed while streaming,
+// as opposed to something the parser had to clean up first.
+func (r *commandRenderer) Rendered(command string) bool {
+	return r.started && strings.TrimSpace(r.shown) == command
+}
+
+func trimPartialTag(s, tag string) string {
+	for i := len(tag) - 1; i > 0; i-- {
+		if strings.HasSuffix(s, tag[:i]) {
+			return s[:len(s)-i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandRendererStructured(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{
+			name:   "whole object",
+			chunks: []string{`{"candidates":[{"command":"ls -la","explanation":"List files"}]}`},
+			want:   "ls -la",
+		},
+		{
+			name:   "split inside the key and value",
+			chunks: []string{`{"candidates":[{"comm`, `and": "find . -na`, `me '*.go'", "risk_level":"low"}]}`},
+			want:   "find . -name '*.go'",
+		},
+		{
+			name:   "split escape",
+			chunks: []string{`{"command":"grep \`, `"TODO\" -r . | wc -l\`, `n"}`},
+			want:   "grep \"TODO\" -r . | wc -l\n",
+		},
+		{
+			name:   "split unicode escape",
+			chunks: []string{`{"command":"echo \u00`, `e9 \ud83d`, `\ude00"}`},
+			want:   "echo é 😀",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			r := newCommandRenderer(&out)
+			for _, chunk := range tt.chunks {
+				r.Write(chunk)
+			}
+			r.Finish()
+			if got := out.String(); got != "Generated command: "+tt.want+"\n" {
+				t.Errorf("rendered %q, want command %q", got, tt.want)
+			}
+			if !r.Rendered(strings.TrimSpace(tt.want)) {
+				t.Errorf("Rendered(%q) = false", tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+)
+
+// StructuredProvider is implemented by providers that can return a JSON
+// object matching a schema, through tool calling or a response schema,
+// instead of free text.
+type StructuredProvider interface {
+	ChatStructured(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput) (string, error)
+}
+
+// StructuredStreamingProvider streams structured output. onDelta receives
+// fragments of the JSON object as they arrive.
+type StructuredStreamingProvider interface {
+	ChatStructuredStream(ctx context.Context, model, apiKey string, messages []AIMessage, output StructuredOutput, onDelta func(string)) (string, error)
+}
+
+// StructuredOutput names and describes the JSON object a structured call
+// returns. Name doubles as the tool name for tool-calling providers.
+type StructuredOutput struct {
+	Name        string
+	Description string
+	Schema      map[string]interface{}
+}
+
+var commandSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"command": map[string]interface{}{
+			"type":        "string",
+			"description": "The CLI command to run, without XML tags or markdown.",
+		},
+		"explanation": map[string]interface{}{
+			"type":        "string",
+			"description": "A short explanation of what the command does.",
+		},
+		"risk_level": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"low", "medium", "high"},
+			"description": "high if the command deletes or overwrites data or changes system settings.",
+		},
+		"requires_sudo": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Whether the command needs root privileges.",
+		},
+		"assumptions": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "Assumptions made about the user's environment or intent.",
+		},
+	},
+	"required":             []string{"command", "explanation", "risk_level", "requires_sudo", "assumptions"},
+	"additionalProperties": false,
+}
+
+var candidatesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"candidates": map[string]interface{}{
+			"type":        "array",
+			"items":       commandSchema,
+			"description": "The proposed commands, best first. A single command unless the user asks for alternatives.",
+		},
+	},
+	"required":             []string{"candidates"},
+	"additionalProperties": false,
+}
+
+var commandsOutput = StructuredOutput{
+	Name:        "propose_commands",
+	Description: "Propose CLI commands that carry out the user's request.",
+	Schema:      candidatesSchema,
+}
+
+func printCommandDetails(cmd Command) {
+	if cmd.Explanation != "" {
+		fmt.Println("Explanation:", cmd.Explanation)
+	}
+	if cmd.RiskLevel != "" {
+		risk := cmd.RiskLevel
+		if cmd.RequiresSudo {
+			risk += " (requires sudo)"
+		}
+		fmt.Println("Risk:", risk)
+	}
+	if len(cmd.Assumptions) > 0 {
+		fmt.Println("Assumptions:")
+		for _, assumption := range cmd.Assumptions {
+			fmt.Println("  -", assumption)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Usage is the token count reported by a provider for one API call. Prompt
+// tokens read from or written to a prompt cache are counted separately.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+}
+
+// update keeps the latest non-zero counts, since streamed responses report
+// usage in whichever events the provider chooses.
+func (u *Usage) update(promptTokens, completionTokens int) {
+	if promptTokens > 0 {
+		u.PromptTokens = promptTokens
+	}
+	if completionTokens > 0 {
+		u.CompletionTokens = completionTokens
+	}
+}
+
+func (u *Usage) updateCache(readTokens, writeTokens int) {
+	if readTokens > 0 {
+		u.CacheReadTokens = readTokens
+	}
+	if writeTokens > 0 {
+		u.CacheWriteTokens = writeTokens
+	}
+}
+
+type LedgerEntry struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Kind             string    `json:"kind"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CacheReadTokens  int       `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int       `json:"cache_write_tokens,omitempty"`
+	Cost             float64   `json:"cost"`
+}
+
+// ModelPrice is the price in USD per million tokens. A model matches the
+// longest Model prefix, so dated snapshots share the base model's price.
+// Cached prompt tokens are billed at CacheRead and CacheWrite.
+type ModelPrice struct {
+	Model      string  `mapstructure:"model"`
+	Input      float64 `mapstructure:"input"`
+	Output     float64 `mapstructure:"output"`
+	CacheRead  float64 `mapstructure:"cache_read"`
+	CacheWrite float64 `mapstructure:"cache_write"`
+}
+
+var defaultPrices = []ModelPrice{
+	{Model: "gpt-4o", Input: 2.50, Output: 10.00},
+	{Model: "gpt-4o-mini", Input: 0.15, Output: 0.60},
+	{Model: "text-embedding-3-small", Input: 0.02},
+	{Model: "text-embedding-3-large", Input: 0.13},
+	{Model: "claude-3-5-sonnet", Input: 3.00, Output: 15.00, CacheRead: 0.30, CacheWrite: 3.75},
+	{Model: "claude-3-5-haiku", Input: 0.80, Output: 4.00, CacheRead: 0.08, CacheWrite: 1.00},
+	{Model: "claude-3-opus", Input: 15.00, Output: 75.00, CacheRead: 1.50, CacheWrite: 18.75},
+	{Model: "claude-3-haiku", Input: 0.25, Output: 1.25, CacheRead: 0.03, CacheWrite: 0.30},
+	{Model: "gemini-1.5-flash", Input: 0.075, Output: 0.30},
+	{Model: "gemini-1.5-pro", Input: 1.25, Output: 5.00},
+	{Model: "voyage-3", Input: 0.06},
+	{Model: "voyage-3-lite", Input: 0.02},
+}
+
+type usageKey struct{}
+
+// withUsage returns a context that adds up the usage reported by every API
+// call made with it.
+func withUsage(ctx context.Context) (context.Context, *Usage) {
+	usage := &Usage{}
+	return context.WithValue(ctx, usageKey{}, usage), usage
+}
+
+func reportUsage(ctx context.Context, usage Usage) {
+	if total, ok := ctx.Value(usageKey{}).(*Usage); ok {
+		total.PromptTokens += usage.PromptTokens
+		total.CompletionTokens += usage.CompletionTokens
+		total.CacheReadTokens += usage.CacheReadTokens
+		total.CacheWriteTokens += usage.CacheWriteTokens
+	}
+}
+
+func recordUsage(provider, model string, requestType RequestType, usage Usage) {
+	kind := "chat"
+	if requestType == EmbeddingsRequest {
+		kind = "embeddings"
+	}
+	entry := LedgerEntry{
+		Time:             time.Now(),
+		Provider:         provider,
+		Model:            model,
+		Kind:             kind,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CacheReadTokens:  usage.CacheReadTokens,
+		CacheWriteTokens: usage.CacheWriteTokens,
+		Cost:             estimateCost(model, usage),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(storeDir, usageFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("Failed to record usage: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		fmt.Printf("Failed to record usage: %v\n", err)
+	}
+}
+
+func readLedger() ([]LedgerEntry, error) {
+	f, err := os.Open(filepath.Join(storeDir, usageFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []LedgerEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func estimateCost(model string, usage Usage) float64 {
+	price, ok := modelPrice(model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output +
+		float64(usage.CacheReadTokens)*price.CacheRead + float64(usage.CacheWriteTokens)*price.CacheWrite) / 1e6
+}
+
+// cacheSavings is what the cached prompt tokens would have cost at the
+// input price, less what they did cost. Cache writes cost more than input,
+// so it is negative until the cache is read.
+func cacheSavings(entry LedgerEntry) float64 {
+	if entry.CacheReadTokens == 0 && entry.CacheWriteTokens == 0 {
+		return 0
+	}
+	price, ok := modelPrice(entry.Model)
+	if !ok {
+		return 0
+	}
+	return (float64(entry.CacheReadTokens)*(price.Input-price.CacheRead) +
+		float64(entry.CacheWriteTokens)*(price.Input-price.CacheWrite)) / 1e6
+}
+
+// modelPrice looks the model up in the pricing list from the config, then
+// in the built-in prices.
+func modelPrice(model string) (ModelPrice, bool) {
+	var prices []ModelPrice
+	if err := viper.UnmarshalKey("pricing", &prices); err == nil {
+		if price, ok := matchPrice(prices, model); ok {
+			return price, true
+		}
+	}
+	return matchPrice(defaultPrices, model)
+}
+
+func matchPrice(prices []ModelPrice, model string) (ModelPrice, bool) {
+	var best ModelPrice
+	found := false
+	for _, price := range prices {
+		if price.Model != "" && strings.HasPrefix(model, price.Model) && len(price.Model) > len(best.Model) {
+			best = price
+			found = true
+		}
+	}
+	return best, found
+}
+
+func spending(entries []LedgerEntry, now time.Time) (day, month float64) {
+	year, mon, d := now.Date()
+	for _, entry := range entries {
+		ey, em, ed := entry.Time.In(now.Location()).Date()
+		if ey == year && em == mon {
+			month += entry.Cost
+			if ed == d {
+				day += entry.Cost
+			}
+		}
+	}
+	return day, month
+}
+
+// exceededBudget returns the budget period that has been used up, if any.
+func exceededBudget(now time.Time) (period string, limit, spent float64) {
+	daily := viper.GetFloat64("budget.daily")
+	monthly := viper.GetFloat64("budget.monthly")
+	if daily <= 0 && monthly <= 0 {
+		return "", 0, 0
+	}
+	entries, err := readLedger()
+	if err != nil {
+		fmt.Printf("Failed to read usage ledger: %v\n", err)
+	}
+	day, month := spending(entries, now)
+	switch {
+	case daily > 0 && day >= daily:
+		return "daily", daily, day
+	case monthly > 0 && month >= monthly:
+		return "monthly", monthly, month
+	}
+	return "", 0, 0
+}
+
+// budgetChain applies the spending budgets to the provider chain. Once a
+// budget is used up, calls are blocked or, with the downgrade action, sent
+// only to the downgrade provider.
+func budgetChain(chain []ChainEntry) ([]ChainEntry, error) {
+	period, limit, spent := exceededBudget(time.Now())
+	if period == "" {
+		return chain, nil
+	}
+	if viper.GetString("budget.action") == "downgrade" {
+		var downgrade ChainEntry
+		if err := viper.UnmarshalKey("budget.downgrade", &downgrade); err == nil && downgrade.Provider != "" {
+			fmt.Printf("%s budget of $%.2f used up ($%.2f spent). Using %s.\n", capitalize(period), limit, spent, downgrade.Provider)
+			return []ChainEntry{downgrade}, nil
+		}
+	}
+	return chain, fmt.Errorf("%w: %s budget of $%.2f used up ($%.2f spent)", ErrBudgetExceeded, period, limit, spent)
+}
+
+type usageTotals struct {
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	CacheReadTokens  int
+	CacheWriteTokens int
+	Cost             float64
+	CacheSavings     float64
+}
+
+func showUsage(by string, days int) error {
+	entries, err := readLedger()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	since := time.Time{}
+	if days > 0 {
+		year, month, day := now.Date()
+		since = time.Date(year, month, day-days+1, 0, 0, 0, 0, now.Location())
+	}
+
+	totals := map[string]*usageTotals{}
+	var sum usageTotals
+	for _, entry := range entries {
+		if entry.Time.Before(since) {
+			continue
+		}
+		var key string
+		switch by {
+		case "day":
+			key = entry.Time.In(now.Location()).Format("2006-01-02")
+		case "provider":
+			key = entry.Provider
+		case "model":
+			key = entry.Provider + " " + entry.Model
+		default:
+			return fmt.Errorf("Invalid grouping %q: use day, provider or model", by)
+		}
+		t, ok := totals[key]
+		if !ok {
+			t = &usageTotals{}
+			totals[key] = t
+		}
+		for _, acc := range []*usageTotals{t, &sum} {
+			acc.Calls++
+			acc.PromptTokens += entry.PromptTokens
+			acc.CompletionTokens += entry.CompletionTokens
+			acc.CacheReadTokens += entry.CacheReadTokens
+			acc.CacheWriteTokens += entry.CacheWriteTokens
+			acc.Cost += entry.Cost
+			acc.CacheSavings += cacheSavings(entry)
+		}
+	}
+
+	if sum.Calls == 0 {
+		fmt.Println("No usage recorded.")
+	} else {
+		keys := make([]string, 0, len(totals))
+		for key := range totals {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tCALLS\tPROMPT\tCOMPLETION\tCACHE READ\tCACHE WRITE\tCOST\n", strings.ToUpper(by))
+		for _, key := range keys {
+			t := totals[key]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t$%.4f\n", key, t.Calls, t.PromptTokens, t.CompletionTokens, t.CacheReadTokens, t.CacheWriteTokens, t.Cost)
+		}
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\t%d\t$%.4f\n", sum.Calls, sum.PromptTokens, sum.CompletionTokens, sum.CacheReadTokens, sum.CacheWriteTokens, sum.Cost)
+		w.Flush()
+		if sum.CacheReadTokens > 0 || sum.CacheWriteTokens > 0 {
+			fmt.Printf("Prompt caching saved $%.4f\n", sum.CacheSavings)
+		}
+	}
+
+	day, month := spending(entries, now)
+	if daily := viper.GetFloat64("budget.daily"); daily > 0 {
+		fmt.Printf("Today: $%.2f of $%.2f daily budget\n", day, daily)
+	}
+	if monthly := viper.GetFloat64("budget.monthly"); monthly > 0 {
+		fmt.Printf("This month: $%.2f of $%.2f monthly budget\n", month, monthly)
+	}
+	showHedgeStats()
+	return nil
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show token usage and estimated cost",
+	Long:  `Report the tokens used and the estimated cost of API calls, grouped by day, provider or model.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defer closeStore()
+		by, _ := cmd.Flags().GetString("by")
+		days, _ := cmd.Flags().GetInt("days")
+		return showUsage(by, days)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(usageCmd)
+	usageCmd.Flags().String("by", "day", "Group usage by day, provider or model")
+	usageCmd.Flags().Int("days", 30, "Number of days to include, 0 for all")
+}
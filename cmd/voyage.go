@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+)
+
+type VoyageEmbeddingRequest struct {
+	Input     []string `json:"input"`
+	Model     string   `json:"model"`
+	InputType string   `json:"input_type,omitempty"`
+}
+
+const voyageEmbeddingsURL = "https://api.voyageai.com/v1/embeddings"
+
+// voyageProvider only provides embeddings for the semantic cache.
+type voyageProvider struct{}
+
+func init() {
+	registerProvider(voyageProvider{})
+}
+
+func (voyageProvider) Name() string { return "Voyage" }
+
+func (voyageProvider) Auth() AuthRequirements {
+	return AuthRequirements{APIKeyEnv: "VOYAGE_API_KEY"}
+}
+
+func (voyageProvider) DefaultEmbeddingModel() string { return "voyage-3" }
+
+func (voyageProvider) SupportsChat() bool { return false }
+
+func (voyageProvider) SupportsEmbeddings() bool { return true }
+
+func (voyageProvider) ListModels() ([]string, error) {
+	return []string{"voyage-3", "voyage-3-lite", "voyage-code-2"}, nil
+}
+
+func (voyageProvider) Chat(ctx context.Context, model, apiKey string, messages []AIMessage) (string, error) {
+	return "", fmt.Errorf("Voyage only provides embeddings")
+}
+
+func (voyageProvider) Embeddings(ctx context.Context, model, apiKey, input string) ([]float32, error) {
+	req := VoyageEmbeddingRequest{
+		Input:     []string{input},
+		Model:     model,
+		InputType: "query",
+	}
+	return makeAPICall(ctx, voyageEmbeddingsURL, req, openAIHeaders(apiKey), processEmbeddingResponse)
+}